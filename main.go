@@ -5,611 +5,937 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"net/url"
+	"net"
 	"os"
-	"path/filepath"
-	"regexp"
-	"runtime"
-	"strconv"
-	"strings"
+	"time"
 
+	"github.com/cockroachdb/backport/pkg/backport"
 	"github.com/google/go-github/v29/github"
 	"github.com/spf13/pflag"
-	"golang.org/x/oauth2"
 )
 
-const usage = `usage: backport [-f] [-c <commit>] [-r <release> | -b <branch>] <pull-request>...
-   or: backport [--continue|--abort]`
+const usage = `usage: backport [-f] [-c <commit>] [--grep <regexp>] [-r <release> | -b <branch>] <pull-request>...
+   or: backport [-r <release> | -b <branch>] --merge-commit <sha>
+   or: backport [-r <release> | -b <branch>] --sha <commit>...
+   or: backport --to master <pull-request>...
+   or: backport forwardport <pull-request>...
+   or: backport [--continue [--resolution <notes>]|--abort [--keep-branch|--stay]|--status]
+   or: backport --scan [--since <duration>]
+   or: backport adopt <backport-branch> | --from-bundle <file>
+   or: backport annotate [-n] [--no-comment] <pull-request> <backport-pr-or-commit>
+   or: backport auth login|logout
+   or: backport completion bash|zsh|fish
+   or: backport bisect-missing [-r <release> | -b <branch>] <path>...
+   or: backport deps [-r <release> | -b <branch>] <pull-request>...
+   or: backport reconcile -r <release>
+   or: backport prefetch [--interval <duration>]
+   or: backport releases
+   or: backport stale
+   or: backport wizard`
 
 const helpString = `backport attempts to automatically backport GitHub pull requests to a
 release branch.
 
+Pull requests may be given as plain numbers (23437 or #23437), as
+cockroachdb/cockroach#23437, or as GitHub URLs. Alternatively,
+--merge-commit SHA backports everything that a merge commit on master
+brought in: the PRs it merged are read from its subject, be it a GitHub
+merge, a bors-style 'Merge #123 #456', or a squash merge ending in
+'(#123)', or are otherwise looked up on GitHub.
+
+To forward-port PRs that merged into a release branch first, like
+hotfixes, onto master, use --to master or 'backport forwardport'. The
+result is a regular backport branch, but the PR body says
+'Forward-port' and the title drops the release branch prefix of the
+source PR.
+
+With --sha, the arguments are commits rather than PRs, e.g. for a fix
+that landed on master without a PR, or a single commit of a PR that has
+not merged yet. Commits that are not available locally are fetched from
+upstream by their full SHA. The PR title is the subject of the commit,
+or asked for if there are several, and the body lists the commits and
+repeats their messages. The backport branch is named after the first
+commit, as in backport23.1-g00c6a87a1b.
+
+When backporting several PRs together, backport cannot generate a title,
+so it asks for one, unless --title or --edit is given or stdin is not a
+terminal, in which case the title is left as 'release-X.Y: TODO'.
+
 By default, backport will cherry-pick all commits in the specified PRs.
+For merged PRs, these are the commits that actually landed on master,
+which may differ from the PR's commit listing if commits were dropped
+along the way or if the PR went through a merge queue, be it bors-style
+or GitHub's, that merged or rebased it. A squash-merged PR is backported
+as its single squashed commit. PRs that have not been merged yet are
+refused unless --force is specified, as their commits may still change.
+Commits that are already on the target branch, e.g. because part of a PR
+was backported before, are skipped with a notice.
 If you explicitly list commits on the command line, backport will
-cherry-pick only the mentioned commits.
+cherry-pick only the mentioned commits. Prefix a commit with '!' to
+exclude it instead; an exclusion of the form '!re:<regexp>' excludes
+every commit whose subject matches the regular expression. When several
+PRs are given, a commit may be scoped to one of them, as in
+'-c 23437:00c6a87', so that short SHAs cannot match commits in other PRs.
+If a short SHA matches several commits anyway, backport lists them and
+asks which one you meant.
+Use --grep to cherry-pick only the commits whose messages match a pattern.
+With --interactive, backport lists the commits, along with the files they
+touch, and lets you toggle which ones to cherry-pick before it starts.
 
 If manual conflict resolution is required, backport will quit so you
 can use standard Git commands to resolve the conflict. After you have
 resolved the conflict, resume backporting with 'backport --continue'.
-To give up instead, run 'backport --abort'.
+To give up instead, run 'backport --abort'. To keep the commits that were
+cherry-picked before the conflict on the backport branch, add
+--keep-branch; to stop cherry-picking but finish the backport by hand
+and then run 'backport --continue', add --stay. 'backport --status'
+shows which commits have been applied so far and which remain.
+
+When a backport required conflict resolution, 'backport --continue'
+asks how the conflicts were resolved and records the answer in a
+"Conflict resolution" section of the PR body. Use --resolution to supply
+the answer up front.
+
+If neither --release nor --branch is specified, backport targets the
+releases named by the PRs' backport-X.Y.x labels, after asking for
+confirmation. PRs without such labels are backported to the latest
+release.
+
+The release passed to --release may also be one of the aliases 'stable'
+(the newest release branch), 'prev' (the release before it), or 'lts'.
+Aliases, including 'lts', can be mapped to a specific release by
+running 'git config backport.alias.ALIAS RELEASE'. The branches
+considered release branches can be changed by setting
+backport.releaseBranchPattern to a regular expression. To make 'stable' and
+'prev' ignore release branches that have not yet had a published
+release, run 'git config backport.skipUnreleased true'. Releases and
+point releases, like 23.1 or 23.1.12-rc, map to release-23.1 and
+release-23.1.12-rc; anything else, like staging-v23.1.12, is taken to be
+the branch to backport to, as with --branch.
+
+Flags that should apply to every invocation can be stored in the
+backport.defaultFlags Git config option, e.g. by running
+'git config backport.defaultFlags "--force"'. Flags given on the command
+line take precedence over these defaults.
+
+With --worktree, the backport branch is checked out in a temporary Git
+worktree, so the current checkout, including any uncommitted changes, is
+left alone. The worktree is removed once the backport is submitted or
+aborted. To always work this way, add --worktree to backport.defaultFlags.
+
+Each GitHub API request times out after 30s. This limit can be changed
+by running 'git config backport.requestTimeout DURATION'. Requests that
+read from GitHub are retried up to three times, with exponential backoff,
+if they time out or fail transiently, e.g. with a 502 or on a secondary
+rate limit, in which case backport waits as long as GitHub asks. Use
+--timeout to additionally bound the total time spent waiting on GitHub,
+retries included.
+
+Code freezes can be recorded with
+'git config --add backport.freeze "BRANCH START END"', where START and
+END are dates like 2024-01-15. backport refuses to target a branch
+during its freeze unless --force is specified.
+
+'backport releases' (or --releases) lists the upstream release branches
+with the --release value that selects each, its latest tag, the date of
+its last commit, and its status: open, frozen, unsupported (older than
+backport.minRelease), and whether it is in its stability period, i.e.
+has no published release yet.
+
+List the paths where bad backports do the most harm in the multi-valued
+backport.dangerousPath option, e.g. pkg/clusterversion or a glob like
+pkg/upgrade/*.go. Backports touching them trigger a loud warning and must
+be confirmed at a prompt, or with --force if there is no terminal.
+
+To protect releases that are past the end of their support, set
+backport.minRelease to the oldest release that accepts backports, e.g.
+in .backportrc. Backporting to an older release then requires confirming
+it at a prompt and giving a justification, which is recorded in the PR
+body.
+
+To generate PR bodies from a Go template (text/template) instead, e.g.
+to include the sections that your repository requires, commit it as
+.github/BACKPORT_TEMPLATE.md or point backport.template at it. Templates
+are passed .Branch, .Release, .Justification, .References, .Message (the
+default body), and .PRs, each with .Number, .Title, .Author, .Body,
+.BaseBranch, .Commits, and .SelectedCommits (commit counts). The
+justification for backporting to an unsupported release is only included
+in templated bodies via .Justification. Unless the body names each PR like
+.Message does ("N/M commits from #123."), a line naming it is appended, as
+backport finds existing backports by it.
+
+To append trailers to every backported commit, list them as Go templates
+in the multi-valued backport.trailer option, typically in .backportrc:
+
+    [backport]
+        trailer = "Release-branch: {{.Branch}}"
+
+Templates are passed .Branch, .Release (e.g. 23.2), and .PRs (the PR
+numbers). The trailers are added just before the backport is pushed.
+
+With --edit, backport opens the PR title and body in your Git editor
+before pushing, as 'git commit' does: the first line is the title, and the
+rest is the body.
+
+Before a backport PR is opened, its title and body are checked by the
+linters listed in the multi-valued backport.lint Git config option:
+'no-todo-title', 'section:NAME' (require a non-empty NAME section), and
+'exec:COMMAND' (run COMMAND with the title and body on stdin).
+To fix a title or body that failed the checks, give --edit, --title,
+--body, or --body-file to 'backport --continue'.
+
+To remind reviewers of what matters for a release, e.g. a platform that
+it still ships but master no longer does, list the items in the
+multi-valued backport.release-X.Y.check option, typically in .backportrc:
+
+    [backport "release-23.1"]
+        check = "linux-arm64 build (ci/arm64) passes"
+
+They are added to the PR body as a checklist, along with the items in
+backport.check, which apply to every release.
+
+backport also warns when the commits appear to use version gates,
+cluster settings, or exported identifiers from other packages that do not
+exist on the target branch, and lists them in the PR body.
+
+When a bug reproduces on a release branch but not on master,
+'backport bisect-missing' lists the commits on master that touch the given
+paths but are missing from the release branch, as candidates for the fix to
+backport. Commits with a "Release note (bug fix)", that fix an issue, or
+whose subject mentions a bug are listed first.
+
+When the PR is created via the GitHub API, e.g. with --create-pr, the
+labels of the source PRs are copied to it, except for backport-* labels
+and those matching any of the glob patterns in the multi-valued
+backport.excludeLabel option.
+With --label-from-title, it is also labeled for the areas named by the
+conventional prefixes of the source PRs' titles, e.g. sql and kv for
+'sql,kv: fix foo', so that dashboards filtering on area labels keep
+working. Map areas, or glob patterns of areas, to labels with the
+multi-valued backport.areaLabel option, e.g.
+'git config --add backport.areaLabel "sql/* A-sql-optimizer"'.
+
+Reviews are requested from the authors and approvers of the source PRs,
+and from the upstream teams named by the multi-valued backport.reviewTeam
+option, e.g. release-eng, and each source PR is commented on with a link
+to the backport PR, unless --no-comment is given to backport or to
+'backport --continue'. Labels, teams, and milestones that do not exist
+upstream, and reviewers whose review cannot be requested, are skipped
+with a warning rather than failing the backport.
+Such PRs are also added to the open milestone for the next release from
+the target branch: for release-X.Y, the milestone X.Y.Z (or vX.Y.Z) with
+the lowest Z, or else X.Y. To use another milestone, run
+'git config backport.BRANCH.milestone TITLE'. The PR body mentions the
+team named by backport.releaseTeam, which defaults to release in
+cockroachdb repositories; set it to none to mention no team.
+
+The generated PR body repeats the "Epic:" and "Informs:" references found
+in the source PRs' bodies and commit messages.
+
+To avoid duplicate work, backport refuses to backport a PR to a branch
+that already has an open backport PR for it, unless --force is specified
+or --close-superseded will close the existing PR.
+
+backport also looks for merged PRs that claim to fix or follow up on the
+PRs being backported, and offers to include them in the backport.
+
+If a cherry-pick conflicts, backport looks for earlier PRs that touched
+the same lines but were never backported, and offers to restart the
+backport with them included.
+
+'backport wizard' guides you through a backport: it asks for the PRs,
+which you can pick from a search among merged PRs or from your own
+recently merged ones, then for their commits and, from a checklist of
+the newest releases, the target releases. It then previews, for each
+release, whether the commits apply cleanly, and shows the equivalent
+backport command before running it. Other flags, like --draft, are
+passed through. With a single --release, e.g. 'backport wizard -r 23.1',
+the PRs labeled for backport to it are offered instead of your own.
+
+'backport completion SHELL' prints a completion script for bash, zsh, or
+fish. Besides subcommands, flags, and releases, it completes PR numbers
+with the PRs merged most recently that are labeled for backport to the
+release given with --release, or else to the latest release, as listed by
+'backport completion prs [RELEASE]'.
+
+'backport prefetch' fetches master and the supported release branches,
+i.e., those no older than backport.minRelease or else the newest four,
+into local refs under refs/backport/prefetch/. For the next 15 minutes
+(or backport.prefetchMaxAge), backports use these copies instead of
+fetching, which skips the slow fetch phase, unless a PR merged after the
+prefetch. Run it with --interval, e.g. in the background or from cron
+with a 5m interval, to keep the copies fresh.
+
+'backport stale' considers a backport PR stale once its base branch has
+gained 50 commits that the PR lacks, or once it no longer merges cleanly.
+The threshold can be changed by running
+'git config backport.staleThreshold COMMITS'.
+
+With --cascade, backport creates a backport for every release branch from
+the newest one down to the oldest release given with --release, in that
+order. Add --stack to cherry-pick each of these backports from the
+previous one rather than from master, so that conflicts resolved for a
+newer release need not be resolved again for an older one.
+
+PRs usually target master, but a PR that targets a release branch, such
+as an earlier backport, may be backported again to another release branch,
+e.g. from release-24.1 to release-23.2. The generated PR body then notes
+the PR that the earlier backport came from.
+
+By default, all the given PRs are backported together on one branch.
+With --separate, each PR is backported on its own branch and in its own
+PR instead, so that independent changes can be reverted independently.
+The resulting backports run one after the other, like those for several
+releases below.
+
+When --release is given more than once, a separate backport branch and
+PR is created for each release, one after the other. If one of them
+requires conflict resolution, the rest resume after 'backport --continue';
+'backport --abort' cancels them all.
+
+When backport stops, it prints a summary of each backport of the run:
+its PR or pushed branch and the reviewers requested, or whether it
+stopped, e.g. on a conflict, or is still queued, followed by the commands
+that take it from there.
 
 To determine what Git remote to push to, backport looks at the value of
 the cockroach.remote Git config option. You can set this option by
 running 'git config cockroach.remote REMOTE-NAME'.
 
+To push to a URL rather than a remote, e.g. because your fork is reachable
+only via SSH while the remote uses HTTPS, run
+'git config backport.pushURL URL'. Your GitHub username is taken from the
+push URL or, if it cannot be, from the GitHub API, in which case your fork
+must have the same name as the upstream repository. To name the owner of
+your fork explicitly, run 'git config backport.forkOwner USERNAME'.
+Before cherry-picking, backport checks via the GitHub API that the fork is
+a fork of the upstream repository, possibly via another fork, and that you
+can push to it. If the fork is named differently from the upstream
+repository, as forks of forks often are, the PR names the fork along with
+its owner, so that GitHub does not pick another repository of the owner.
+
+To hand a conflicting backport off to someone else, add --bundle FILE:
+if a cherry-pick conflicts, backport writes the backport branch and a
+report of the conflict, including the commits left to cherry-pick, to FILE
+as a Git bundle. 'backport adopt --from-bundle FILE' recreates the
+backport from the bundle on another machine and repeats the conflicting
+cherry-pick for you to resolve.
+
+To push to a fork shared by your team instead, so that anyone can take
+over a colleague's in-flight backport with 'backport adopt', run
+'git config backport.sharedFork REMOTE-NAME'. Backport branches in a shared
+fork are namespaced by your GitHub username, e.g.
+you/backport23.1-23437, which is taken from the github.user Git config
+option or, failing that, from the GitHub API.
+
+backport recognizes existing backports, e.g. to skip them in --scan and
+reconcile, by the source PRs named in the body of the backport PR. To
+account for a backport made by hand, or before backport was used, run
+'backport annotate PR BACKPORT', where BACKPORT is the merged backport PR
+or a commit it merged. This appends a line naming PR to the body of
+BACKPORT, labels PR backport-X.Y.x if the label exists, and comments on
+PR with a link to BACKPORT, unless --no-comment is given. With --dry-run,
+it only prints what it would record.
+
+The upstream repository defaults to the cockroachdb repository with the
+same name as that remote. To backport to a different repository, run
+'git config backport.upstream OWNER/REPO'.
+
+backport fetches upstream branches by URL, except in a partial clone,
+e.g. one made with 'git clone --filter=blob:none', where it fetches
+through the promisor remote for upstream so that the clone's filter
+applies and objects are only downloaded once they are needed. If no
+promisor remote fetches from upstream, backport warns and explains how to
+configure one.
+
+To use backport with GitHub Enterprise Server, point it at the API with
+'git config backport.githubAPI https://HOST/api/v3/'. The upload URL is
+derived from it unless backport.githubUpload is set.
+
+backport authenticates to GitHub with the personal access token in the
+BACKPORT_GITHUB_TOKEN or GITHUB_TOKEN environment variable, in that
+order, or else with the one stored by 'backport auth login'. That
+command reads a token from the terminal, or from stdin, and stores it
+for the GitHub host in the macOS Keychain, the Secret Service keyring on
+Linux (via secret-tool), or the Windows Credential Manager; 'backport
+auth logout' deletes it. The token may also be set in plain text in
+cockroach.githubToken, which is deprecated. Without a token, backport
+works read-only: it can plan backports, e.g. with --dry-run, and push
+them for you to open the PR in your browser, but cannot create PRs via
+the API or set their labels, reviewers, or milestone. To stretch the
+strict rate limit on unauthenticated requests, their responses are
+cached and revalidated, which the rate limit does not count if nothing
+changed. The listing of the upstream branches, which takes many
+requests, is cached for 10 minutes (or backport.cacheTTL) without
+revalidation, with or without a token, so a new release branch may take
+as long to be noticed.
+
+'backport --scan' backports the PRs merged to master within the last day
+(or --since DURATION) whose backport-X.Y.x labels have no matching open or
+merged backport PR yet. Each backport is attempted in a temporary worktree
+and opened via the GitHub API. If one conflicts, or fails because of the
+PR itself, it is abandoned, and the source PR is commented on and labeled
+backport-failed so that someone can backport it by hand; scans skip PRs
+with that label. Backports that fail transiently, e.g. because GitHub or
+the network is down, are abandoned quietly and retried by the next scan.
+--scan never prompts, so it can be run periodically by a bot account,
+e.g. from cron or CI.
+
+With --ci, backport is suitable for CI jobs such as a GitHub Actions
+workflow_dispatch job: it never prompts or launches a browser, creates
+the PR via the API, e.g. with the GITHUB_TOKEN that the workflow
+provides, and writes the pr-url and branch step outputs to
+$GITHUB_OUTPUT (or stdout). cockroach.remote must still name a remote
+for the fork to push to.
+
+To commit the backported commits as someone other than yourself, e.g. as
+a team's release bot in automation, pass --committer "NAME <EMAIL>" or
+set backport.committer. The commits keep their authors. A repository can
+require the committer email to match one of the glob patterns in the
+multi-valued backport.allowedCommitterEmail option, e.g.
+'*@cockroachlabs.com', typically in .backportrc.
+
+In CI jobs, which start from a fresh clone of a big repository, fetching
+the full history of master and the release branches takes a while. With
+--depth N, or backport.fetchDepth, backport fetches only the last N
+commits of each branch, making the clone shallow, and deepens the history
+automatically if the backport needs more of it. With --filter SPEC, or
+backport.fetchFilter, it fetches with a Git object filter, e.g. blob:none
+to leave out file contents until the cherry-picks need them, which
+requires a partial clone whose promisor remote fetches from upstream.
+Avoid --depth in a full clone you work in, as it cuts off its history.
+
+With --output json, each message is printed to stdout as a JSON object
+on a line of its own, with time, level, message, and, for errors, hint
+fields, and the output of Git commands goes to stderr. This suits bots and
+other programs that drive backport.
+
+Any of the configuration options above may also be set in a .backportrc
+file at the top of the repository, e.g. to share them with everyone
+working on it, or in ~/.config/backport/config. Both files use Git's configuration
+syntax. Git's own configuration takes precedence over .backportrc, which
+takes precedence over the global file. For safety, cockroach.githubToken,
+backport.githubAPI, backport.githubUpload, backport.lint,
+backport.defaultFlags, backport.pushURL, backport.committer, and
+backport.template are not read from .backportrc.
+A default release can be configured by adding '--release X.Y' to
+backport.defaultFlags.
+
 Options:
 
        --continue           resume an in-progress backport
+       --resolution <notes> with --continue, describe how conflicts were
+                            resolved in the PR body
        --abort              cancel an in-progress backport
+       --keep-branch        with --abort, keep the commits picked so far
+       --stay               with --abort, cancel only the current
+                            cherry-pick and stay on the backport branch
+       --status             describe the in-progress backport
+       --scan               backport recently merged PRs per their labels
+       --since <duration>   with --scan, how far back to look (default 24h)
+       --interval <duration>
+                            with prefetch, keep prefetching at this interval
   -c,  --commit <commit>    only cherry-pick the mentioned commits
-  -r,  --release <release>  select release to backport to
+       --grep <regexp>      only cherry-pick commits whose messages match
+  -i,  --interactive        choose the commits to cherry-pick from a list
+  -r,  --release <release>  select release to backport to; may be repeated
   -b,  --branch <branch>    select the branch to backport to
+       --to master          forward-port PRs merged into a release branch
+       --remote <remote>    push to this remote instead of cockroach.remote
+       --committer <ident>  commit as "NAME <EMAIL>" instead of as yourself
+       --depth <n>          fetch only the last n commits of each branch,
+                            deepening as needed
+       --filter <spec>      fetch with this object filter, e.g. blob:none
+       --merge-commit <sha> backport the PRs merged by this master commit
+       --sha                backport the commits given as arguments rather
+                            than PRs
   -f,  --force              live on the edge
+       --no-verify          skip the backport.lint and compatibility checks
+       --title <title>      use this PR title instead of generating one
+       --body <body>        use this PR body instead of generating one
+       --body-file <file>   read the PR body from a file ("-" for stdin)
+       --bundle <file>      on conflict, write the backport to a bundle
+  -e,  --edit               edit the PR title and body before pushing
+       --create-pr          create the PR via the GitHub API instead of
+                            opening it in a web browser
+       --draft              create the PR as a draft (implies --create-pr)
+       --close-superseded   close open backport PRs to the same branch whose
+                            source PRs are all included in the new PR,
+                            with a comment linking to it (implies
+                            --create-pr)
+       --no-comment         do not comment on the source PRs with a link to
+                            the backport PR
+       --label-from-title   add area labels for the source PRs' title
+                            prefixes, per backport.areaLabel
+       --auto-resolve=trivial
+                            retry conflicting cherry-picks with rename
+                            detection, whitespace-insensitive merging,
+                            and the patience diff algorithm
+       --ignore-whitespace  ignore whitespace changes when cherry-picking
+  -x,  --record-origin      add "(cherry picked from commit ...)" to each
+                            backported commit message; can be made the
+                            default with 'git config backport.recordOrigin
+                            true'
+       --ci                 run non-interactively, e.g. in GitHub Actions
+                            (implies --create-pr)
+       --worktree           cherry-pick in a temporary Git worktree rather
+                            than switching branches in this checkout
+       --cascade            backport to every release from the newest down
+                            to the oldest one given with --release
+       --stack              with --cascade, cherry-pick each backport from
+                            the previous one to reuse conflict resolution
+       --separate           create a separate backport branch and PR for
+                            each pull request
+       --squash             squash the commits from each pull request into
+                            a single commit referencing it
+  -n,  --dry-run            print the commits, branch, and PR that would be
+                            created without changing anything; fetches
+                            ignore --depth and --filter
+       --timeout <duration> give up on GitHub API calls after this long
+       --notify             send a desktop notification when done or stuck
+       --output <format>    render output as text, tty (colored text), or
+                            json (one JSON object per line); defaults to
+                            tty in a terminal and text otherwise
        --help               display this help
 
+Commands:
+
+       adopt                resume tracking an existing backport branch
+                            whose backport state was lost
+       annotate             record that a merged backport PR, or the PR
+                            of a commit, made by hand backports a PR
+       auth login|logout    store the GitHub token in the OS keychain, or
+                            delete it from there
+       bisect-missing       list commits on master touching the given paths
+                            that are missing from the release branch
+       completion           print the shell completion script for bash,
+                            zsh, or fish
+       deps                 list the changes missing from the target
+                            release that the PRs' diffs depend on
+       forwardport          port PRs merged into a release branch to
+                            master; same as --to master
+       reconcile            report PRs whose backport-X.Y.x label disagrees
+                            with the backports merged to release-X.Y
+       prefetch             fetch master and the supported release branches
+                            ahead of time to speed up backports
+       releases             list the release branches with their -r value,
+                            latest tag, last commit date, and status; also
+                            available as --releases
+       stale                list your open backport PRs that have fallen
+                            behind or conflict with their base branch
+       wizard               walk through choosing the PRs, commits, and
+                            releases to backport, step by step
+
 Example invocations:
 
     $ backport 23437
     $ backport 23389 23437 -r 1.1 -c 00c6a87 -c a26506b -c '!a32f4ce'
+    $ backport 23389 23437 -c 23389:00c6a87 -c '!23437:re:^docs:'
+    $ backport 23437 -c '!re:^docs:'
+    $ backport 23437 --grep '#98765'
+    $ backport --sha 00c6a87a1b2c3d4e5f60718293a4b5c6d7e8f901 -r 23.1
+    $ backport 23437 -r prev
+    $ backport 23389 23437 -r 23.1 --dry-run
+    $ backport 23389 23437 --separate
+    $ backport 23437 -r 23.1 --cascade --stack
+    $ backport 23437 -r 23.1 -r 22.2
+    $ backport forwardport 23501
+    $ backport 23389 23437 --title 'release-23.1: sql: fix foo and bar'
     $ backport 23437 -b release-23.1.10-rc  # backport to the 'release-23.1.10-rc' branch
     $ backport --continue
-    $ backport --abort`
+    $ backport --abort
+    $ backport --status
+    $ backport adopt backport23.1-23437
+    $ backport adopt --from-bundle backport23.1-23437.bundle
+    $ backport annotate 23437 23502
+    $ backport auth login
+    $ backport bisect-missing -r 23.1 pkg/sql/opt pkg/sql/rowexec
+    $ source <(backport completion bash)
+    $ backport deps 23437 -r 23.1
+    $ backport reconcile -r 23.2
+    $ backport prefetch --interval 5m &
+    $ backport releases
+    $ backport stale
+    $ backport wizard
+    $ backport --scan --since 2h`
+
+// commands are the subcommands of backport, for shell completion.
+var commands = []string{
+	"adopt", "annotate", "auth", "bisect-missing", "completion", "deps", "forwardport",
+	"prefetch", "reconcile", "releases", "stale", "wizard",
+}
+
+// renderer presents the output of backport, as selected by --output.
+var renderer backport.Renderer = backport.TextRenderer{Stdout: os.Stdout, Stderr: os.Stderr}
 
 func main() {
 	if err := run(context.Background()); err != nil {
-		fmt.Fprintf(os.Stderr, "fatal: %s\n", err)
-
+		var hint string
 		if errors.As(err, new(*github.RateLimitError)) {
-			fmt.Fprintln(os.Stderr, `hint: unauthenticated GitHub requests are subject to a very strict rate
-limit. Please configure backport with a personal access token:
-
-			$ git config cockroach.githubToken TOKEN
-
-For help creating a personal access token, see https://goo.gl/Ep2E6x.`)
-		} else if e := (hintedErr{}); errors.As(err, &e) {
-			fmt.Fprintf(os.Stderr, "hint: %s\n", e.hint)
+			hint = `unauthenticated GitHub requests are subject to a very strict rate
+limit. Please configure backport with a personal access token, either by
+storing it in the OS keychain or in the BACKPORT_GITHUB_TOKEN environment
+variable:
+
+			$ backport auth login
+
+For help creating a personal access token, see https://goo.gl/Ep2E6x.`
+		} else if netErr := net.Error(nil); errors.As(err, &netErr) && netErr.Timeout() {
+			hint = `the GitHub API did not respond in time. If you are behind a proxy,
+check that it allows access to api.github.com. Otherwise, try raising the
+limits with --timeout or 'git config backport.requestTimeout DURATION'.`
+		} else {
+			hint, _ = backport.ErrorHint(err)
 		}
+		renderer.Fatal(err.Error(), hint)
 
 		os.Exit(1)
 	}
 }
 
-var force bool
-
 func run(ctx context.Context) error {
-	var cont, abort, help bool
-	var commits []string
-	var release string
-	var branch string
+	var cont, abort, status, scan, releases, help, notifyFlag bool
+	var keepBranch, stay bool
+	var opts backport.Options
+	var resolution, bodyFile, output, fromBundle, to string
+	var timeout, since, interval time.Duration
 
 	pflag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
 	pflag.BoolVarP(&help, "help", "h", false, "")
 	pflag.BoolVar(&cont, "continue", false, "")
 	pflag.BoolVar(&abort, "abort", false, "")
-	pflag.BoolVarP(&force, "force", "f", false, "")
-	pflag.StringArrayVarP(&commits, "commit", "c", nil, "")
-	pflag.StringVarP(&release, "release", "r", "", "")
-	pflag.StringVarP(&branch, "branch", "b", "", "")
+	pflag.BoolVar(&status, "status", false, "")
+	pflag.BoolVar(&scan, "scan", false, "")
+	pflag.BoolVar(&releases, "releases", false, "")
+	pflag.DurationVar(&since, "since", 24*time.Hour, "")
+	pflag.DurationVar(&interval, "interval", 0, "")
+	pflag.BoolVar(&keepBranch, "keep-branch", false, "")
+	pflag.BoolVar(&stay, "stay", false, "")
+	pflag.StringVar(&resolution, "resolution", "", "")
+	pflag.BoolVarP(&opts.Force, "force", "f", false, "")
+	pflag.BoolVar(&opts.NoVerify, "no-verify", false, "")
+	pflag.StringArrayVarP(&opts.Commits, "commit", "c", nil, "")
+	pflag.StringArrayVar(&opts.Greps, "grep", nil, "")
+	pflag.BoolVarP(&opts.Interactive, "interactive", "i", false, "")
+	pflag.StringArrayVarP(&opts.Releases, "release", "r", nil, "")
+	pflag.StringVarP(&opts.Branch, "branch", "b", "", "")
+	pflag.StringVar(&to, "to", "", "")
+	pflag.StringVar(&opts.Remote, "remote", "", "")
+	pflag.StringVar(&opts.Committer, "committer", "", "")
+	pflag.IntVar(&opts.Depth, "depth", 0, "")
+	pflag.StringVar(&opts.Filter, "filter", "", "")
+	pflag.StringVar(&opts.MergeCommit, "merge-commit", "", "")
+	pflag.BoolVar(&opts.SHA, "sha", false, "")
+	pflag.StringVar(&opts.Title, "title", "", "")
+	pflag.StringVar(&opts.Body, "body", "", "")
+	pflag.BoolVarP(&opts.Edit, "edit", "e", false, "")
+	pflag.StringVar(&bodyFile, "body-file", "", "")
+	pflag.StringVar(&opts.Bundle, "bundle", "", "")
+	pflag.StringVar(&fromBundle, "from-bundle", "", "")
+	pflag.BoolVar(&opts.CreatePR, "create-pr", false, "")
+	pflag.BoolVar(&opts.Draft, "draft", false, "")
+	pflag.StringVar(&opts.AutoResolve, "auto-resolve", "", "")
+	pflag.BoolVar(&opts.IgnoreSpace, "ignore-whitespace", false, "")
+	pflag.BoolVarP(&opts.RecordOrigin, "record-origin", "x", false, "")
+	pflag.BoolVar(&opts.Worktree, "worktree", false, "")
+	pflag.BoolVarP(&opts.DryRun, "dry-run", "n", false, "")
+	pflag.BoolVar(&opts.Separate, "separate", false, "")
+	pflag.BoolVar(&opts.Squash, "squash", false, "")
+	pflag.BoolVar(&opts.Cascade, "cascade", false, "")
+	pflag.BoolVar(&opts.Stack, "stack", false, "")
+	pflag.BoolVar(&opts.CloseSuperseded, "close-superseded", false, "")
+	pflag.BoolVar(&opts.NoComment, "no-comment", false, "")
+	pflag.BoolVar(&opts.LabelFromTitle, "label-from-title", false, "")
+	pflag.BoolVar(&opts.CI, "ci", false, "")
+	pflag.DurationVar(&timeout, "timeout", 0, "")
+	pflag.BoolVar(&notifyFlag, "notify", false, "")
+	pflag.StringVar(&output, "output", "", "")
 	pflag.Parse()
+	if err := applyDefaultFlags(); err != nil {
+		return err
+	}
+	if err := setRenderer(output); err != nil {
+		return err
+	}
 
 	if help {
 		printHelp()
 		return nil
 	}
 
-	if (cont || abort) && len(os.Args) != 2 {
-		return errors.New(usage)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	if cont {
-		return runContinue(ctx)
-	} else if abort {
-		return runAbort(ctx)
+	if (cont || abort || status || scan || releases) && pflag.NArg() != 0 {
+		return errors.New(usage)
 	}
-	return runBackport(ctx, pflag.Args(), commits, release, branch)
-}
-
-func printHelp() {
-	fmt.Fprintln(os.Stderr, usage)
-	fmt.Fprintln(os.Stderr)
-	fmt.Fprintln(os.Stderr, helpString)
-}
-
-func runBackport(ctx context.Context, prArgs, commitArgs []string, releaseArg string, branchArg string) error {
-	if len(prArgs) == 0 {
-		printHelp()
-		return fmt.Errorf("missing arguments")
+	if (keepBranch || stay) && !abort {
+		return errors.New("--keep-branch and --stay may only be used with --abort")
 	}
-	if releaseArg != "" && branchArg != "" {
-		printHelp()
-		return fmt.Errorf("cannot specify --release and --branch at the same time")
+	if keepBranch && stay {
+		return errors.New("cannot specify --keep-branch and --stay at the same time")
 	}
 
-	var prNos []int
-	for _, prArg := range prArgs {
-		prNo, err := strconv.Atoi(prArg)
-		if err != nil {
-			return fmt.Errorf("%q is not a valid pull request number", prArg)
+	if to != "" {
+		if opts.Branch != "" || len(opts.Releases) > 0 {
+			printHelp()
+			return errors.New("cannot specify --to with --release or --branch")
 		}
-		prNos = append(prNos, prNo)
+		opts.Branch = to
 	}
 
-	c, err := loadConfig(ctx)
-	if err != nil {
-		return err
-	}
-
-	if ok, err := isBackporting(c); err != nil {
-		return err
-	} else if ok {
-		return errors.New("backport already in progress")
-	}
-
-	pullRequests, err := loadPullRequests(ctx, c, prNos)
-	if err != nil {
-		return err
-	}
-
-	if !force {
-		for _, pr := range pullRequests {
-			if pr.baseBranch != "master" {
-				return fmt.Errorf("PR #%d targets %s, not master; are you backporting a backport?",
-					pr.number, pr.baseBranch)
-			}
+	if bodyFile != "" {
+		if opts.Body != "" {
+			printHelp()
+			return errors.New("cannot specify --body and --body-file at the same time")
+		}
+		var in []byte
+		var err error
+		if bodyFile == "-" {
+			in, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			in, err = ioutil.ReadFile(bodyFile)
 		}
-	}
-
-	if err := pullRequests.selectCommits(commitArgs); err != nil {
-		return err
-	}
-
-	destBranch := getDestinationBranch(ctx, c, releaseArg, branchArg)
-
-	// Order is important here. releaseBranch is fetched last so that we can
-	// check it out below using FETCH_HEAD.
-	for _, branch := range []string{"master", destBranch.branch} {
-		err = spawn("git", "fetch", "https://github.com/cockroachdb/cockroach.git",
-			"refs/heads/"+branch)
 		if err != nil {
-			return fmt.Errorf("fetching %q branch: %w", branch, err)
+			return fmt.Errorf("reading body file: %w", err)
 		}
+		opts.Body = string(in)
 	}
 
-	backportBranch := fmt.Sprintf("backport%s-%s", destBranch.backportBranchSuffix, strings.Join(prArgs, "-"))
-	err = spawn("git", "checkout", whenForced("--force", "--no-force"),
-		whenForced("-B", "-b"), backportBranch, "FETCH_HEAD")
-	if err != nil {
-		return fmt.Errorf("creating backport branch %q: %w", backportBranch, err)
-	}
-
-	query := url.Values{}
-	query.Add("expand", "1")
-	query.Add("title", pullRequests.title(destBranch))
-	query.Add("body", pullRequests.message())
-	backportURL := fmt.Sprintf("https://github.com/cockroachdb/cockroach/compare/%s...%s:%s?%s",
-		destBranch.branch, c.username, backportBranch, query.Encode())
-
-	err = ioutil.WriteFile(c.urlFile(), []byte(backportURL), 0644)
-	if err != nil {
-		return fmt.Errorf("writing url file: %w", err)
-	}
-
-	err = spawn(append([]string{"git", "cherry-pick"}, pullRequests.selectedCommits()...)...)
-	if err != nil {
-		return hintedErr{
-			error: err,
-			hint: `Automatic cherry-picking failed. This usually indicates that manual
-conflict resolution is required. Run 'backport --continue' to resume
-backporting. To give up instead, run 'backport --abort'.`,
+	prArgs := pflag.Args()
+	if cont {
+		err := backport.Continue(ctx, backport.ContinueOptions{
+			Resolution: resolution,
+			Title:      opts.Title,
+			Body:       opts.Body,
+			Edit:       opts.Edit,
+			CreatePR:   opts.CreatePR,
+			Draft:      opts.Draft,
+			NoComment:  opts.NoComment,
+			Force:      opts.Force,
+			NoVerify:   opts.NoVerify,
+		})
+		if notifyFlag {
+			backport.Notify(err)
 		}
-	}
-
-	return finalize(c, backportBranch, backportURL)
-}
-
-func runContinue(ctx context.Context) error {
-	c, err := loadConfig(ctx)
-	if err != nil {
 		return err
-	}
-
-	if ok, err := isBackporting(c); err != nil {
-		return err
-	} else if !ok {
-		return errors.New("no backport in progress")
-	}
-
-	if ok, err := isCherryPicking(c); err != nil {
-		return err
-	} else if ok {
-		err = spawn("git", "cherry-pick", "--continue")
-		if err != nil {
-			return err
+	} else if releases {
+		return backport.Releases(ctx)
+	} else if abort {
+		return backport.Abort(ctx, backport.AbortOptions{
+			KeepBranch: keepBranch,
+			Stay:       stay,
+			Force:      opts.Force,
+		})
+	} else if status {
+		return backport.Status(ctx)
+	} else if scan {
+		return backport.Scan(ctx, backport.ScanOptions{Since: since, NoVerify: opts.NoVerify})
+	}
+
+	if args := pflag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "adopt":
+			if fromBundle != "" {
+				if len(args) != 1 {
+					printHelp()
+					return errors.New("adopt --from-bundle does not accept a backport branch")
+				}
+				return backport.AdoptBundle(ctx, fromBundle, opts.Force)
+			}
+			if len(args) != 2 {
+				printHelp()
+				return errors.New("adopt requires exactly one backport branch")
+			}
+			return backport.Adopt(ctx, args[1], opts.Force)
+		case "annotate":
+			if len(args) != 3 {
+				printHelp()
+				return errors.New("annotate requires a pull request and its backport")
+			}
+			return withHelp(backport.Annotate(ctx, backport.AnnotateOptions{
+				Source:    args[1],
+				Backport:  args[2],
+				NoComment: opts.NoComment,
+				DryRun:    opts.DryRun,
+				Force:     opts.Force,
+			}))
+		case "auth":
+			if len(args) == 2 && args[1] == "login" {
+				return backport.AuthLogin()
+			} else if len(args) == 2 && args[1] == "logout" {
+				return backport.AuthLogout()
+			}
+			printHelp()
+			return errors.New("auth requires login or logout")
+		case "bisect-missing":
+			if len(opts.Releases) > 1 {
+				printHelp()
+				return errors.New("bisect-missing accepts at most one --release")
+			}
+			bisectOpts := backport.BisectOptions{Branch: opts.Branch, Paths: args[1:]}
+			if len(opts.Releases) == 1 {
+				bisectOpts.Release = opts.Releases[0]
+			}
+			return withHelp(backport.BisectMissing(ctx, bisectOpts))
+		case "completion":
+			if len(args) >= 2 && args[1] == "prs" && len(args) <= 3 {
+				var release string
+				if len(args) == 3 {
+					release = args[2]
+				}
+				return backport.CompletePRs(ctx, release)
+			} else if len(args) == 2 && args[1] == "releases" {
+				return backport.CompleteReleases(ctx)
+			} else if len(args) != 2 {
+				printHelp()
+				return errors.New("completion requires exactly one shell")
+			}
+			var flags []string
+			pflag.VisitAll(func(f *pflag.Flag) {
+				flags = append(flags, "--"+f.Name)
+				if f.Shorthand != "" {
+					flags = append(flags, "-"+f.Shorthand)
+				}
+			})
+			return backport.Completion(args[1], commands, flags)
+		case "deps":
+			opts.PRs = args[1:]
+			return withHelp(backport.Deps(ctx, opts))
+		case "reconcile":
+			if len(args) != 1 {
+				printHelp()
+				return errors.New("reconcile does not accept positional arguments")
+			}
+			if len(opts.Releases) != 1 {
+				printHelp()
+				return errors.New("reconcile requires exactly one --release")
+			}
+			return backport.Reconcile(ctx, opts.Releases[0])
+		case "prefetch":
+			if len(args) != 1 {
+				printHelp()
+				return errors.New("prefetch does not accept positional arguments")
+			}
+			return backport.Prefetch(ctx, interval)
+		case "releases":
+			if len(args) != 1 {
+				printHelp()
+				return errors.New("releases does not accept positional arguments")
+			}
+			return backport.Releases(ctx)
+		case "stale":
+			if len(args) != 1 {
+				printHelp()
+				return errors.New("stale does not accept positional arguments")
+			}
+			return backport.Stale(ctx)
+		case "wizard":
+			if len(args) != 1 {
+				printHelp()
+				return errors.New("wizard does not accept positional arguments")
+			}
+			return withHelp(backport.Wizard(ctx, opts))
+		case "forwardport":
+			if opts.Branch != "" || len(opts.Releases) > 0 {
+				printHelp()
+				return errors.New("forwardport does not accept --release, --branch, or --to")
+			}
+			opts.Branch = "master"
+			prArgs = args[1:]
 		}
 	}
 
-	in, err := ioutil.ReadFile(c.urlFile())
-	if err != nil {
-		return fmt.Errorf("reading url file: %w", err)
+	opts.PRs = prArgs
+	err := withHelp(backport.Run(ctx, opts))
+	if notifyFlag {
+		backport.Notify(err)
 	}
-	backportURL := string(in)
-
-	matches := regexp.MustCompile(`:(backport.*)\?`).FindStringSubmatch(backportURL)
-	if len(matches) == 0 {
-		return fmt.Errorf("malformatted url file: %s", backportURL)
-	}
-	backportBranch := matches[1]
-
-	return finalize(c, backportBranch, backportURL)
+	return err
 }
 
-func runAbort(ctx context.Context) error {
-	c, err := loadConfig(ctx)
-	if err != nil {
-		return err
-	}
-
-	if ok, err := isBackporting(c); err != nil {
-		return err
-	} else if !ok {
-		return errors.New("no backport in progress")
-	}
-
-	err = os.Remove(c.urlFile())
-	if err != nil {
-		return fmt.Errorf("removing url file: %w", err)
-	}
-
-	if ok, err := isCherryPicking(c); err != nil {
-		return err
-	} else if ok {
-		err = spawn("git", "cherry-pick", "--abort")
-		if err != nil {
-			return err
+// setRenderer selects the renderer for the given --output format. By default,
+// output is colored if both stdout and stderr are terminals.
+func setRenderer(format string) error {
+	text := backport.TextRenderer{Stdout: os.Stdout, Stderr: os.Stderr}
+	if format == "" {
+		format = "text"
+		if isTerminal(os.Stdout) && isTerminal(os.Stderr) &&
+			os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" {
+			format = "tty"
 		}
 	}
-
-	return checkoutPrevious()
-}
-
-func finalize(c config, backportBranch, backportURL string) error {
-	err := spawn("git", "push", "-u", whenForced("--force", "--no-force"),
-		c.remote, fmt.Sprintf("%[1]s:%[1]s", backportBranch))
-	if err != nil {
-		return fmt.Errorf("pushing branch: %w", err)
-	}
-
-	err = os.Remove(c.urlFile())
-	if err != nil {
-		return fmt.Errorf("removing url file: %w", err)
-	}
-
-	err = spawn(browserCmd(backportURL)...)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "warning: unable to launch web browser: %s\n", err)
-		fmt.Fprintf(os.Stderr, "Submit PR manually at:\n    %s\n", backportURL)
-	}
-
-	return checkoutPrevious()
-}
-
-func isCherryPicking(c config) (bool, error) {
-	_, err := os.Stat(filepath.Join(c.gitDir, "CHERRY_PICK_HEAD"))
-	if err == nil {
-		return true, nil
-	} else if !os.IsNotExist(err) {
-		return false, fmt.Errorf("checking for in-progress cherry-pick: %w", err)
-	}
-	return false, nil
-}
-
-func isBackporting(c config) (bool, error) {
-	_, err := os.Stat(c.urlFile())
-	if err == nil {
-		return true, nil
-	} else if !os.IsNotExist(err) {
-		return false, fmt.Errorf("checking for in-progress backport: %w", err)
-	}
-	return false, nil
-}
-
-func checkoutPrevious() error {
-	branch, err := capture("git", "rev-parse", "--abbrev-ref", "HEAD")
-	if err != nil {
-		return fmt.Errorf("looking up current branch name: %w", err)
-	}
-	if !regexp.MustCompile(`^backport\d+`).MatchString(branch) {
-		return nil
-	}
-	if err := spawn("git", "checkout", whenForced("--force", "--no-force"), "-"); err != nil {
-		return fmt.Errorf("returning to previous branch: %w", err)
+	switch format {
+	case "text":
+		renderer = text
+	case "tty":
+		renderer = backport.TTYRenderer{TextRenderer: text}
+	case "json":
+		renderer = backport.JSONRenderer{W: os.Stdout}
+	default:
+		printHelp()
+		return fmt.Errorf("unknown --output format %q; expected text, tty, or json", format)
 	}
+	backport.SetRenderer(renderer)
 	return nil
 }
 
-type config struct {
-	ghClient *github.Client
-	remote   string
-	username string
-	gitDir   string
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
-func loadConfig(ctx context.Context) (config, error) {
-	var c config
-
-	// Determine remote.
-	c.remote, _ = capture("git", "config", "--get", "cockroach.remote")
-	if c.remote == "" {
-		return c, hintedErr{
-			error: errors.New("missing cockroach.remote configuration"),
-			hint: `set cockroach.remote to the name of the Git remote to push
-backports to. For example:
-
-    $ git config cockroach.remote origin
-`,
-		}
-	}
-
-	// Determine username.
-	remoteURL, err := capture("git", "remote", "get-url", "--push", c.remote)
-	if err != nil {
-		return c, fmt.Errorf("determining URL for remote %q: %w", c.remote, err)
-	}
-	m := regexp.MustCompile(`github.com(:|/)([[:alnum:]\-]+)`).FindStringSubmatch(remoteURL)
-	if len(m) != 3 {
-		return c, fmt.Errorf("unable to guess GitHub username from remote %q (%s)",
-			c.remote, remoteURL)
-	} else if m[2] == "cockroachdb" {
-		return c, fmt.Errorf("refusing to use unforked remote %q (%s)",
-			c.remote, remoteURL)
-	}
-	c.username = m[2]
-
-	// Build GitHub client.
-	var ghAuthClient *http.Client
-	ghToken, _ := capture("git", "config", "--get", "cockroach.githubToken")
-	if ghToken != "" {
-		ghAuthClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: ghToken}))
-	}
-	c.ghClient = github.NewClient(ghAuthClient)
-
-	// Determine Git directory.
-	c.gitDir, err = capture("git", "rev-parse", "--git-dir")
-	if err != nil {
-		return c, fmt.Errorf("looking up git directory: %w", err)
-	}
-
-	return c, nil
-}
-
-func (c config) urlFile() string {
-	return filepath.Join(c.gitDir, "BACKPORT_URL")
-}
-
-func getLatestRelease(ctx context.Context, c config) (string, error) {
-	opt := &github.BranchListOptions{
-		ListOptions: github.ListOptions{PerPage: 100},
-	}
-	var allBranches []*github.Branch
-	for {
-		branches, res, err := c.ghClient.Repositories.ListBranches(ctx, "cockroachdb", "cockroach", opt)
-		if err != nil {
-			return "", fmt.Errorf("discovering release branches: %w", err)
-		}
-		allBranches = append(allBranches, branches...)
-		if res.NextPage == 0 {
-			break
-		}
-		opt.Page = res.NextPage
-	}
-
-	var lastRelease string
-	for _, branch := range allBranches {
-		if !strings.HasPrefix(branch.GetName(), "release-") {
-			continue
-		}
-		lastRelease = strings.TrimPrefix(branch.GetName(), "release-")
-	}
-	if lastRelease == "" {
-		return "", errors.New("unable to determine latest release; try specifying --release")
-	}
-	return lastRelease, nil
-}
-
-type destinationBranch struct {
-	branch               string // either `release-{major-series}` or `{branch}`, derived from command-line parameter
-	backportBranchSuffix string // suffix to add to the backport branch, derived from the source branch
-}
-
-func getDestinationBranch(ctx context.Context, c config, releaseArg string, branchArg string) *destinationBranch {
-	if branchArg != "" {
-		return &destinationBranch{
-			branch:               branchArg,
-			backportBranchSuffix: branchArg,
-		}
-	}
-	var err error
-	if releaseArg == "" {
-		releaseArg, err = getLatestRelease(ctx, c)
-		if err != nil {
-			panic(err)
-		}
-	}
-	return &destinationBranch{
-		branch:               "release-" + releaseArg,
-		backportBranchSuffix: releaseArg,
-	}
-}
-
-type pullRequest struct {
-	number          int
-	title           string
-	body            string
-	commits         []string
-	selectedCommits []string
-	baseBranch      string
-}
-
-type pullRequests []pullRequest
-
-func loadPullRequests(ctx context.Context, c config, prNos []int) (pullRequests, error) {
-	var prs pullRequests
-	for _, prNo := range prNos {
-		ghPR, _, err := c.ghClient.PullRequests.Get(ctx, "cockroachdb", "cockroach", prNo)
-		if err != nil {
-			return nil, fmt.Errorf("fetching PR #%d: %w", prNo, err)
-		}
-		commits, _, err := c.ghClient.PullRequests.ListCommits(ctx, "cockroachdb", "cockroach", prNo, nil)
-		if err != nil {
-			return nil, fmt.Errorf("fetching commits from PR #%d: %w", prNo, err)
-		}
-		pr := pullRequest{
-			number:     prNo,
-			title:      ghPR.GetTitle(),
-			body:       ghPR.GetBody(),
-			baseBranch: ghPR.GetBase().GetRef(),
-		}
-		for _, c := range commits {
-			pr.commits = append(pr.commits, c.GetSHA())
-			pr.selectedCommits = append(pr.selectedCommits, c.GetSHA())
-		}
-		prs = append(prs, pr)
+// withHelp prints the help text if err reports invalid options.
+func withHelp(err error) error {
+	if errors.As(err, new(backport.UsageError)) {
+		printHelp()
 	}
-	return prs, nil
+	return err
 }
 
-func (prs pullRequests) selectCommits(refs []string) error {
-	var includeRefs []string
-	var excludeRefs []string
-	for _, ref := range refs {
-		if strings.HasPrefix(ref, "!") {
-			excludeRefs = append(excludeRefs, ref[1:])
-		} else {
-			includeRefs = append(includeRefs, ref)
-		}
-	}
-
-	if len(includeRefs) > 0 {
-		for i := range prs {
-			prs[i].selectedCommits = nil
-		}
+// applyDefaultFlags parses the flags configured in backport.defaultFlags,
+// skipping any flag that was explicitly specified on the command line.
+func applyDefaultFlags() error {
+	defaults := backport.DefaultFlags()
+	if len(defaults) == 0 {
+		return nil
 	}
-
-	for _, ref := range includeRefs {
-		var found bool
-		for i := range prs {
-			for _, commit := range prs[i].commits {
-				if strings.HasPrefix(commit, ref) {
-					if found {
-						return fmt.Errorf("commit ref %q is ambiguous", ref)
-					}
-					prs[i].selectedCommits = append(prs[i].selectedCommits, commit)
-					found = true
-				}
+	fs := pflag.NewFlagSet("backport.defaultFlags", pflag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	pflag.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			// Parse, but discard, the default value, so that the command-line
+			// value wins.
+			f = &pflag.Flag{
+				Name:        f.Name,
+				Shorthand:   f.Shorthand,
+				NoOptDefVal: f.NoOptDefVal,
+				Value:       discardValue{f.Value.Type()},
 			}
 		}
-		if !found {
-			return fmt.Errorf("commit %q was not found in any of the specified PRs", ref)
-		}
+		fs.AddFlag(f)
+	})
+	if err := fs.Parse(defaults); err != nil {
+		return fmt.Errorf("parsing backport.defaultFlags: %w", err)
 	}
-
-	for _, ref := range excludeRefs {
-		var found bool
-		for i := range prs {
-			for j, commit := range prs[i].selectedCommits {
-				if strings.HasPrefix(commit, ref) {
-					if found {
-						return fmt.Errorf("commit ref %q is ambiguous", ref)
-					}
-					prs[i].selectedCommits = append(prs[i].selectedCommits[:j], prs[i].selectedCommits[j+1:]...)
-					found = true
-				}
-			}
-		}
-		if !found {
-			return fmt.Errorf("commit %q was not found in any of the specified PRs", ref)
-		}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("backport.defaultFlags may only contain flags, found %q", fs.Arg(0))
 	}
-
 	return nil
 }
 
-func (prs pullRequests) selectedCommits() []string {
-	var commits []string
-	for _, pr := range prs {
-		commits = append(commits, pr.selectedCommits...)
-	}
-	return commits
-}
+// discardValue is a pflag.Value that ignores any value it is set to.
+type discardValue struct{ typ string }
 
-func (prs pullRequests) selectedPRs() pullRequests {
-	var selectedPRs []pullRequest
-	for _, pr := range prs {
-		if len(pr.selectedCommits) > 0 {
-			selectedPRs = append(selectedPRs, pr)
-		}
-	}
-	return selectedPRs
-}
+func (v discardValue) String() string   { return "" }
+func (v discardValue) Set(string) error { return nil }
+func (v discardValue) Type() string     { return v.typ }
 
-func (prs pullRequests) title(destBranch *destinationBranch) string {
-	prs = prs.selectedPRs()
-	if len(prs) == 1 {
-		return fmt.Sprintf("%s: %s", destBranch.branch, prs[0].title)
-	}
-	return fmt.Sprintf("%s: TODO", destBranch.branch)
-}
-
-func (prs pullRequests) message() string {
-	prs = prs.selectedPRs()
-	var s strings.Builder
-	if len(prs) == 1 {
-		fmt.Fprintf(&s, "Backport %d/%d commits from #%d.\n",
-			len(prs[0].selectedCommits), len(prs[0].commits), prs[0].number)
-	} else {
-		fmt.Fprintln(&s, "Backport:")
-		for _, pr := range prs {
-			fmt.Fprintf(&s, "  * %d/%d commits from %q (#%d)\n",
-				len(pr.selectedCommits), len(pr.commits), pr.title, pr.number)
-		}
-		fmt.Fprintln(&s)
-		fmt.Fprintln(&s, "Please see individual PRs for details.")
-	}
-	fmt.Fprintln(&s)
-	fmt.Fprintln(&s, "/cc @cockroachdb/release")
-	if len(prs) == 1 {
-		fmt.Fprintln(&s)
-		fmt.Fprintln(&s, "---")
-		fmt.Fprintln(&s)
-		fmt.Fprintln(&s, prs[0].body)
-	}
-	return s.String()
-}
-
-type hintedErr struct {
-	hint string
-	error
-}
-
-func whenForced(forced, unforced string) string {
-	if force {
-		return forced
-	}
-	return unforced
-}
-
-func browserCmd(url string) []string {
-	var cmd []string
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = append(cmd, "/usr/bin/open")
-	case "windows":
-		cmd = append(cmd, "cmd", "/c", "start")
-	default:
-		cmd = append(cmd, "xdg-open")
-	}
-	cmd = append(cmd, url)
-	return cmd
+func printHelp() {
+	fmt.Fprintln(os.Stderr, usage)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, helpString)
 }
@@ -0,0 +1,148 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// backportBranchRE matches backport branch names, which are namespaced by
+// their author's login in a shared fork, and end in the numbers of the PRs
+// they backport or, for --sha backports, in g and the first commit's SHA.
+var backportBranchRE = regexp.MustCompile(`^(?:[[:alnum:]\-]+/)?backport(.+?)-(\d+(?:-\d+)*|g[0-9a-f]{7,40})$`)
+
+// parseBackportBranch returns the destination branch and the PRs of the
+// backport branch with the given name. There are no PRs for --sha backports.
+func parseBackportBranch(backportBranch string) (*destinationBranch, []int, error) {
+	m := backportBranchRE.FindStringSubmatch(backportBranch)
+	if m == nil {
+		return nil, nil, fmt.Errorf("%q does not look like a backport branch", backportBranch)
+	}
+	destBranch := &destinationBranch{
+		branch:               m[1],
+		backportBranchSuffix: m[1],
+	}
+	if m[1][0] >= '0' && m[1][0] <= '9' {
+		// The "release-" prefix is stripped from backport branch names.
+		destBranch.branch = "release-" + m[1]
+	}
+	if strings.HasPrefix(m[2], "g") {
+		return destBranch, nil, nil
+	}
+	var prNos []int
+	for _, s := range strings.Split(m[2], "-") {
+		prNo, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing PR number in %q: %w", backportBranch, err)
+		}
+		prNos = append(prNos, prNo)
+	}
+	return destBranch, prNos, nil
+}
+
+// runAdopt reconstructs the backport state for an existing backport branch,
+// e.g., after the state file was deleted or the branch was pushed from another
+// machine, so that 'backport --continue' can finish the backport.
+func runAdopt(ctx context.Context, backportBranch string) error {
+	destBranch, prNos, err := parseBackportBranch(backportBranch)
+	if err != nil {
+		return err
+	}
+
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if ok {
+		return errors.New("backport already in progress")
+	}
+
+	if _, err := capture("git", "rev-parse", "--verify", "refs/heads/"+backportBranch); err != nil {
+		// Take the branch over from the fork, e.g. from a colleague who pushed
+		// it to a shared fork.
+		ref := "refs/heads/" + backportBranch
+		if err := spawn("git", "fetch", c.remote, ref+":"+ref); err != nil {
+			return fmt.Errorf("branch %q does not exist locally or in %s: %w", backportBranch, c.remote, err)
+		}
+	}
+
+	pullRequests, err := loadPullRequests(ctx, c, prNos)
+	if err != nil {
+		return err
+	}
+
+	// Work out which of the PRs' commits made it onto the backport branch by
+	// matching commit subjects, as the cherry-picked commits have new SHAs.
+	err = fetchBranches(c, destBranch.branch)
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", destBranch.branch, err)
+	}
+	out, err := capture("git", "log", "--format=%s", "FETCH_HEAD.."+backportBranch)
+	if err != nil {
+		return fmt.Errorf("listing commits on %q: %w", backportBranch, err)
+	}
+	if len(prNos) == 0 {
+		// The commits of a --sha backport are only known by the branch name's
+		// abbreviated SHA, so the picked commits stand in for them, which
+		// keep their messages.
+		picked, err := capture("git", "rev-list", "--reverse", "FETCH_HEAD.."+backportBranch)
+		if err != nil {
+			return fmt.Errorf("listing commits on %q: %w", backportBranch, err)
+		}
+		if picked == "" {
+			return fmt.Errorf("%q has no commits to backport", backportBranch)
+		}
+		raw, err := rawCommits(c, strings.Fields(picked))
+		if err != nil {
+			return err
+		}
+		pullRequests = append(pullRequests, raw)
+	}
+	picked := map[string]bool{}
+	for _, subject := range strings.Split(out, "\n") {
+		picked[subject] = true
+	}
+	var found bool
+	for i := range pullRequests {
+		pullRequests[i].selectedCommits = nil
+		for _, commit := range pullRequests[i].commits {
+			if picked[pullRequests[i].subject(commit)] {
+				pullRequests[i].selectedCommits = append(pullRequests[i].selectedCommits, commit)
+				found = true
+			}
+		}
+	}
+	if !found {
+		// Perhaps the commits were reworded. Assume the whole PRs were
+		// backported rather than generating an empty PR description.
+		for i := range pullRequests {
+			pullRequests[i].selectedCommits = pullRequests[i].commits
+		}
+	}
+
+	if ok, err := isCherryPicking(); err != nil {
+		return err
+	} else if !ok {
+		err = spawn("git", "checkout", whenForced("--force", "--no-force"), backportBranch)
+		if err != nil {
+			return fmt.Errorf("checking out %q: %w", backportBranch, err)
+		}
+	}
+
+	backportURL := compareURL(c, destBranch, backportBranch,
+		pullRequests.title(destBranch), pullRequests.message(destBranch, resolveReleaseTeam(ctx, c)))
+	err = ioutil.WriteFile(c.urlFile(), []byte(backportURL), 0644)
+	if err != nil {
+		return fmt.Errorf("writing url file: %w", err)
+	}
+
+	infof("Adopted %s. Run 'backport --continue' to finish the backport.", backportBranch)
+	return nil
+}
@@ -0,0 +1,49 @@
+package backport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBackportBranch(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		destBranch string
+		suffix     string
+		prNos      []int
+		wantErr    bool
+	}{
+		{name: "backport23.1-23437", destBranch: "release-23.1", suffix: "23.1", prNos: []int{23437}},
+		{name: "backport23.1-23389-23437", destBranch: "release-23.1", suffix: "23.1", prNos: []int{23389, 23437}},
+		{name: "backport23.1.10-rc-23437", destBranch: "release-23.1.10-rc", suffix: "23.1.10-rc", prNos: []int{23437}},
+		{name: "alice/backport23.1-23437", destBranch: "release-23.1", suffix: "23.1", prNos: []int{23437}},
+		{name: "backportstaging-23437", destBranch: "staging", suffix: "staging", prNos: []int{23437}},
+		{name: "backportmaster-23437", destBranch: "master", suffix: "master", prNos: []int{23437}},
+		{name: "backport23.2-g00c6a87a1b", destBranch: "release-23.2", suffix: "23.2"},
+		{name: "alice/backport23.2-g00c6a87a1b", destBranch: "release-23.2", suffix: "23.2"},
+		{name: "backport23.1", wantErr: true},
+		{name: "backport23.1-gxyz", wantErr: true},
+		{name: "feature-23437", wantErr: true},
+		{name: "master", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := backportBranchRE.MatchString(tc.name); got == tc.wantErr {
+				t.Errorf("backportBranchRE.MatchString(%q) = %t", tc.name, got)
+			}
+			destBranch, prNos, err := parseBackportBranch(tc.name)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error: %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if destBranch.branch != tc.destBranch || destBranch.backportBranchSuffix != tc.suffix {
+				t.Errorf("got destination %q with suffix %q, want %q with suffix %q",
+					destBranch.branch, destBranch.backportBranchSuffix, tc.destBranch, tc.suffix)
+			}
+			if !reflect.DeepEqual(prNos, tc.prNos) {
+				t.Errorf("got PRs %v, want %v", prNos, tc.prNos)
+			}
+		})
+	}
+}
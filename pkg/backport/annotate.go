@@ -0,0 +1,168 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// AnnotateOptions controls Annotate.
+type AnnotateOptions struct {
+	Source    string // the PR that was backported
+	Backport  string // the merged backport PR, or a commit it merged
+	NoComment bool   // skip commenting on the source PR
+	DryRun    bool   // print what would be recorded without recording it
+	Force     bool
+}
+
+// Annotate records that an existing backport, made by hand, backports a PR,
+// so that backport accounts for it like for the backports it made itself.
+func Annotate(ctx context.Context, opts AnnotateOptions) error {
+	defer saveState()()
+	force = opts.Force
+	return runAnnotate(ctx, opts)
+}
+
+var shaRE = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// resolveBackportPR returns the merged backport PR given by arg: a PR number,
+// reference, or URL, or the SHA of a commit that a merged PR brought to a
+// release branch.
+func resolveBackportPR(ctx context.Context, c config, arg string) (*github.PullRequest, error) {
+	if prNos, err := parsePRArgs(c, []string{arg}); err == nil {
+		pr, _, err := c.ghClient.PullRequests.Get(ctx, c.upstreamOwner, c.upstreamRepo, prNos[0])
+		if err != nil {
+			return nil, fmt.Errorf("fetching PR #%d: %w", prNos[0], err)
+		}
+		return pr, nil
+	}
+	if !shaRE.MatchString(arg) {
+		return nil, UsageError{fmt.Errorf("%q is not a pull request number, URL, or commit", arg)}
+	}
+	sha := arg
+	if full, err := capture("git", "rev-parse", "--verify", "--quiet", arg+"^{commit}"); err == nil {
+		sha = full
+	}
+	prs, _, err := c.ghClient.PullRequests.ListPullRequestsWithCommit(ctx, c.upstreamOwner, c.upstreamRepo, sha, nil)
+	if err != nil {
+		return nil, fmt.Errorf("looking up the PR of commit %s: %w", arg, err)
+	}
+	for _, pr := range prs {
+		if !pr.GetMergedAt().IsZero() && pr.GetBase().GetRef() != "master" {
+			return pr, nil
+		}
+	}
+	return nil, hintedErr{
+		error: fmt.Errorf("commit %s did not merge to a release branch via a PR", arg),
+		hint: `the link is recorded in the body of the backport PR, so commits pushed
+to a release branch directly cannot be annotated.`,
+	}
+}
+
+// runAnnotate records that the merged backport PR, perhaps made by hand or
+// before backport existed, backports the source PR, the way that backport
+// records it for its own backports: by naming the source PR in the body of
+// the backport PR. Lookups of existing backports, e.g. by reconcile, --scan,
+// and the merge summaries, then account for it. The source PR is also labeled
+// for backport to the release, if the label exists, and, unless NoComment is
+// set, gets a comment linking to the backport PR.
+func runAnnotate(ctx context.Context, opts AnnotateOptions) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	prNos, err := parsePRArgs(c, []string{opts.Source})
+	if err != nil {
+		return UsageError{err}
+	}
+	sourceNo := prNos[0]
+	source, _, err := c.ghClient.PullRequests.Get(ctx, c.upstreamOwner, c.upstreamRepo, sourceNo)
+	if err != nil {
+		return fmt.Errorf("fetching PR #%d: %w", sourceNo, err)
+	}
+	if source.GetMergedAt().IsZero() && !force {
+		return fmt.Errorf("PR #%d has not merged", sourceNo)
+	}
+	bp, err := resolveBackportPR(ctx, c, opts.Backport)
+	if err != nil {
+		return err
+	}
+	if bp.GetNumber() == sourceNo {
+		return errors.New("a PR cannot be a backport of itself")
+	}
+	if bp.GetMergedAt().IsZero() && !force {
+		return fmt.Errorf("backport PR #%d has not merged", bp.GetNumber())
+	}
+	destBranch := bp.GetBase().GetRef()
+	if destBranch == source.GetBase().GetRef() && !force {
+		return fmt.Errorf("PR #%d targets %s, like PR #%d", bp.GetNumber(), destBranch, sourceNo)
+	}
+
+	var recorded bool
+	for _, src := range backportSources(bp.GetBody()) {
+		recorded = recorded || src == sourceNo
+	}
+	var label string
+	if release := strings.TrimPrefix(destBranch, "release-"); release != destBranch {
+		label = backportLabel(release)
+		for _, l := range source.Labels {
+			if l.GetName() == label {
+				label = ""
+			}
+		}
+	}
+
+	if opts.DryRun {
+		if recorded {
+			infof("PR #%d already records that it backports #%d to %s.", bp.GetNumber(), sourceNo, destBranch)
+		} else {
+			infof("Would record in the body of PR #%d that it backports #%d to %s.", bp.GetNumber(), sourceNo, destBranch)
+		}
+		if label != "" {
+			infof("Would label #%d %s.", sourceNo, label)
+		}
+		if !opts.NoComment && !recorded {
+			infof("Would comment on #%d with a link to #%d.", sourceNo, bp.GetNumber())
+		}
+		return nil
+	}
+
+	if recorded {
+		infof("PR #%d already records that it backports #%d to %s.", bp.GetNumber(), sourceNo, destBranch)
+	} else {
+		// The line matches backportSourceRE, like the bodies generated by
+		// pullRequests.message.
+		body := strings.TrimRight(bp.GetBody(), "\n") +
+			fmt.Sprintf("\n\nRecorded by `backport annotate`: backports commits from #%d.", sourceNo)
+		_, _, err := c.ghClient.PullRequests.Edit(ctx, c.upstreamOwner, c.upstreamRepo, bp.GetNumber(),
+			&github.PullRequest{Body: github.String(strings.TrimLeft(body, "\n"))})
+		if err != nil {
+			return fmt.Errorf("editing the body of PR #%d: %w", bp.GetNumber(), err)
+		}
+		infof("Recorded in the body of PR #%d that it backports #%d to %s.", bp.GetNumber(), sourceNo, destBranch)
+	}
+	if label != "" {
+		if labels := existingLabels(ctx, c, []string{label}); len(labels) > 0 {
+			_, _, err := c.ghClient.Issues.AddLabelsToIssue(ctx, c.upstreamOwner, c.upstreamRepo, sourceNo, labels)
+			if err != nil {
+				return fmt.Errorf("labeling #%d: %w", sourceNo, err)
+			}
+			infof("Labeled #%d %s.", sourceNo, label)
+		}
+	}
+	// A recorded backport was announced when it was made by backport, or
+	// when it was annotated before.
+	if !opts.NoComment && !recorded {
+		comment := fmt.Sprintf("Backported to %s in #%d.", destBranch, bp.GetNumber())
+		_, _, err := c.ghClient.Issues.CreateComment(ctx, c.upstreamOwner, c.upstreamRepo, sourceNo,
+			&github.IssueComment{Body: github.String(comment)})
+		if err != nil {
+			warnf("unable to comment on #%d: %s", sourceNo, err)
+		}
+	}
+	return nil
+}
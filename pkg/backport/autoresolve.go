@@ -0,0 +1,50 @@
+package backport
+
+import (
+	"strings"
+)
+
+// trivialStrategies are the increasingly lenient merge strategy options with
+// which --auto-resolve=trivial retries a conflicting cherry-pick.
+var trivialStrategies = [][]string{
+	{"-Xfind-renames=25%"},
+	{"-Xfind-renames=25%", "-Xignore-space-change"},
+	{"-Xfind-renames=25%", "-Xignore-all-space"},
+	{"-Xfind-renames=25%", "-Xignore-all-space", "-Xdiff-algorithm=patience"},
+}
+
+// cherryPickLeniently cherry-picks commits one at a time. When a commit
+// conflicts, it is retried with each of trivialStrategies in turn. If none of
+// them apply the commit cleanly, the remaining commits are cherry-picked as
+// usual, leaving the conflict for the user to resolve.
+func cherryPickLeniently(commits []string, extraArgs []string) error {
+	for i, commit := range commits {
+		if ok := tryCherryPick(commit, extraArgs); ok {
+			continue
+		}
+		var resolved bool
+		for _, strategy := range trivialStrategies {
+			if tryCherryPick(commit, append(extraArgs, strategy...)) {
+				infof("note: cherry-picked %.10s with %s", commit, strings.Join(strategy, " "))
+				resolved = true
+				break
+			}
+		}
+		if !resolved {
+			args := append([]string{"git", "cherry-pick"}, extraArgs...)
+			return spawn(append(args, commits[i:]...)...)
+		}
+	}
+	return nil
+}
+
+// tryCherryPick attempts to cherry-pick a single commit, quietly rolling back
+// the attempt if it fails.
+func tryCherryPick(commit string, extraArgs []string) bool {
+	args := append([]string{"git", "cherry-pick"}, extraArgs...)
+	if _, err := capture(append(args, commit)...); err != nil {
+		_, _ = capture("git", "cherry-pick", "--abort")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,2708 @@
+// Package backport automatically backports GitHub pull requests to release
+// branches. It is the engine behind the backport command, and operates on the
+// Git repository in the current working directory. Progress is reported on
+// stdout and stderr, and some steps prompt for confirmation when stdin is a
+// terminal.
+//
+// The functions in this package are not safe for concurrent use.
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"golang.org/x/oauth2"
+)
+
+// Options controls a backport. The corresponding flags of the backport
+// command are noted alongside each option.
+type Options struct {
+	PRs         []string // the PRs to backport, as numbers, references, or URLs
+	Commits     []string // -c arguments
+	Greps       []string // --grep arguments
+	Interactive bool     // --interactive: toggle the commits to backport in a picker
+	Edit        bool     // --edit: edit the PR title and body before pushing
+	Bundle      string   // --bundle: where to write a bundle on conflict
+	SHA         bool     // --sha: PRs are commits to backport without a PR
+	MergeCommit string   // --merge-commit: backport the PRs this master commit merged
+	Releases    []string // -r arguments
+	Branch      string   // -b argument
+	Remote      string   // --remote argument, overriding cockroach.remote
+	Committer   string   // --committer: "NAME <EMAIL>" to commit as
+	Depth       int      // --depth: how many commits of each branch to fetch
+	Filter      string   // --filter: the object filter to fetch with
+	Title       string   // overrides the generated PR title
+	Body        string   // overrides the generated PR body
+	CreatePR    bool     // create the PR via the API instead of in a browser
+	Draft       bool     // create the PR as a draft; implies CreatePR
+
+	// CloseSuperseded closes the open backport PRs replaced by the new one;
+	// implies CreatePR.
+	CloseSuperseded bool
+	// NoComment skips commenting on the source PRs with a link to the
+	// backport PR, which is otherwise done when the PR is created via the API.
+	NoComment bool
+	// LabelFromTitle adds the area labels that backport.areaLabel maps the
+	// source PRs' title prefixes to.
+	LabelFromTitle bool
+
+	// AutoResolve, if set to "trivial", retries conflicting cherry-picks with
+	// more lenient merge options.
+	AutoResolve string
+	IgnoreSpace bool // cherry-pick with -Xignore-all-space
+	// RecordOrigin cherry-picks with -x, so that each backported commit notes
+	// the commit it was cherry-picked from. It is also enabled by
+	// backport.recordOrigin.
+	RecordOrigin bool
+	Worktree     bool // cherry-pick in a temporary worktree
+	DryRun       bool // print the plan without changing anything
+	Separate     bool // create one backport per PR
+	Squash       bool // squash each PR's commits into one
+	Cascade      bool // backport to every release down to the oldest -r
+	Stack        bool // with Cascade, stack each backport on the previous one
+
+	Force    bool // -f
+	NoVerify bool // skip the backport.lint checks
+
+	// CI runs non-interactively, e.g. in GitHub Actions: nothing prompts, the
+	// PR is created via the API, and the results are written as step outputs.
+	// Implies CreatePR.
+	CI bool
+}
+
+// Run backports the PRs in opts. If the cherry-pick requires manual conflict
+// resolution, Run returns an error, and the backport can be finished with
+// Continue once the conflicts are resolved, or cancelled with Abort.
+func Run(ctx context.Context, opts Options) error {
+	defer saveState()()
+	force, noVerify = opts.Force, opts.NoVerify
+	remoteOverride = opts.Remote
+	depthOverride, filterOverride = opts.Depth, opts.Filter
+	// Draft PRs can only be created via the API, as can PRs that need to
+	// know their own number to close the PRs they supersede.
+	opts.CreatePR = opts.CreatePR || opts.Draft || opts.CloseSuperseded || opts.CI
+	summary.c, summary.finished = nil, nil
+	if !opts.CI {
+		err := runBackport(ctx, opts.PRs, opts)
+		printSummary(err)
+		return err
+	}
+
+	ciMode, batch = true, true
+	ciCreated.urls, ciCreated.branches = nil, nil
+	err := runBackport(ctx, opts.PRs, opts)
+	printSummary(err)
+	if err != nil {
+		return err
+	}
+	return writeCIOutputs()
+}
+
+// Deps reports the changes that the PRs in opts depend on but that are
+// missing from the target release branches, without modifying the
+// repository.
+func Deps(ctx context.Context, opts Options) error {
+	defer saveState()()
+	force, noVerify = opts.Force, opts.NoVerify
+	return runDeps(ctx, opts.PRs, opts)
+}
+
+// ContinueOptions controls how an in-progress backport is resumed.
+type ContinueOptions struct {
+	Resolution string // how conflicts were resolved, for the PR body
+	Title      string // overrides the PR title of the in-progress backport
+	Body       string // overrides the PR body of the in-progress backport
+	Edit       bool   // edit the PR title and body before pushing
+	CreatePR   bool   // create the PR via the API instead of in a browser
+	Draft      bool   // create the PR as a draft; implies CreatePR
+	NoComment  bool   // skip commenting on the source PRs
+	Force      bool
+	NoVerify   bool // skip the backport.lint checks
+}
+
+// Continue resumes the in-progress backport after conflicts were resolved.
+func Continue(ctx context.Context, opts ContinueOptions) error {
+	defer saveState()()
+	force, noVerify = opts.Force, opts.NoVerify
+	if opts.Edit && !isInteractive() {
+		return UsageError{errors.New("--edit requires a terminal")}
+	}
+	summary.c, summary.finished = nil, nil
+	err := runContinue(ctx, opts)
+	printSummary(err)
+	return err
+}
+
+// AbortOptions controls how an in-progress backport is cancelled.
+type AbortOptions struct {
+	KeepBranch bool // keep the commits picked so far
+	Stay       bool // cancel only the current cherry-pick
+	Force      bool
+}
+
+// Abort cancels the in-progress backport.
+func Abort(ctx context.Context, opts AbortOptions) error {
+	defer saveState()()
+	force = opts.Force
+	return runAbort(ctx, opts.KeepBranch, opts.Stay)
+}
+
+// Status describes the in-progress backport, if any.
+func Status(ctx context.Context) error {
+	return runStatus(ctx)
+}
+
+// Adopt reconstructs the backport state for an existing backport branch.
+func Adopt(ctx context.Context, backportBranch string, forced bool) error {
+	defer saveState()()
+	force = forced
+	return runAdopt(ctx, backportBranch)
+}
+
+// AdoptBundle takes over the backport in a conflict bundle written with
+// --bundle.
+func AdoptBundle(ctx context.Context, path string, forced bool) error {
+	defer saveState()()
+	force = forced
+	return runAdoptBundle(ctx, path)
+}
+
+// Reconcile cross-checks the backport label for release against the
+// backports merged into its release branch.
+func Reconcile(ctx context.Context, release string) error {
+	return runReconcile(ctx, release)
+}
+
+// Releases lists the upstream release branches with their latest tag, last
+// commit date, and freeze status.
+func Releases(ctx context.Context) error {
+	return runReleases(ctx)
+}
+
+// Prefetch keeps local copies of master and the supported release branches,
+// which backports use instead of fetching while they are fresh. With a
+// positive interval, it refreshes them at that interval until it is stopped.
+func Prefetch(ctx context.Context, interval time.Duration) error {
+	return runPrefetch(ctx, interval)
+}
+
+// AuthLogin stores a GitHub token, read from the terminal or stdin, in the OS
+// keychain, where backport finds it at runtime.
+func AuthLogin() error {
+	return runAuthLogin()
+}
+
+// AuthLogout deletes the GitHub token stored by AuthLogin.
+func AuthLogout() error {
+	return runAuthLogout()
+}
+
+// Completion prints the script that sets up completion of backport in shell,
+// which completes the given subcommands and flags.
+func Completion(shell string, commands, flags []string) error {
+	return runCompletion(shell, commands, flags)
+}
+
+// CompletePRs prints the recently merged PRs labeled for backport to release,
+// or to the latest release if it is empty, for shell completion.
+func CompletePRs(ctx context.Context, release string) error {
+	return runCompletePRs(ctx, release)
+}
+
+// CompleteReleases prints the values of --release, for shell completion.
+func CompleteReleases(ctx context.Context) error {
+	return runCompleteReleases(ctx)
+}
+
+// Stale lists the user's open backport PRs that need a refresh.
+func Stale(ctx context.Context) error {
+	return runStale(ctx)
+}
+
+// DefaultFlags returns the flags configured in backport.defaultFlags.
+func DefaultFlags() []string {
+	return strings.Fields(gitConfig("backport.defaultFlags"))
+}
+
+// UsageError is returned when the options passed to this package are
+// invalid or inconsistent.
+type UsageError struct {
+	error
+}
+
+// ErrorHint returns the hint attached to err, if any, describing how to
+// proceed.
+func ErrorHint(err error) (string, bool) {
+	if e := (hintedErr{}); errors.As(err, &e) {
+		return e.hint, true
+	}
+	return "", false
+}
+
+var force bool
+
+// remoteOverride, if set, names the remote to push to instead of
+// cockroach.remote.
+var remoteOverride string
+
+// depthOverride and filterOverride, if set, override backport.fetchDepth and
+// backport.fetchFilter.
+var (
+	depthOverride  int
+	filterOverride string
+)
+
+// noVerify disables the backport.lint checks.
+var noVerify bool
+
+// committerEnv are the environment variables that useCommitter sets.
+var committerEnv = []string{"GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL"}
+
+// saveState snapshots the process state that the exported functions of the
+// package change for the duration of a call, i.e. its package variables, the
+// committer environment variables, and the working directory, which
+// enterWorktree changes, and returns a function that restores it. Each
+// exported function that changes any of it defers that function, so that one
+// call does not affect the next, e.g. a forced Abort a later Run.
+func saveState() (restore func()) {
+	savedForce, savedNoVerify, savedBatch, savedCIMode := force, noVerify, batch, ciMode
+	savedRemote, savedDepth, savedFilter := remoteOverride, depthOverride, filterOverride
+	savedSummary, savedCICreated := summary, ciCreated
+	env := map[string]*string{}
+	for _, key := range committerEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			env[key] = &v
+		} else {
+			env[key] = nil
+		}
+	}
+	wd, wdErr := os.Getwd()
+	return func() {
+		force, noVerify, batch, ciMode = savedForce, savedNoVerify, savedBatch, savedCIMode
+		remoteOverride, depthOverride, filterOverride = savedRemote, savedDepth, savedFilter
+		summary, ciCreated = savedSummary, savedCICreated
+		for key, v := range env {
+			if v != nil {
+				os.Setenv(key, *v)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+		if wdErr == nil {
+			if err := os.Chdir(wd); err != nil {
+				warnf("unable to return to %s: %s", wd, err)
+			}
+		}
+	}
+}
+
+func runBackport(ctx context.Context, prArgs []string, opts Options) error {
+	if len(prArgs) == 0 && opts.MergeCommit == "" {
+		return UsageError{errors.New("missing arguments")}
+	}
+	if len(prArgs) > 0 && opts.MergeCommit != "" {
+		return UsageError{errors.New("cannot specify pull requests and --merge-commit at the same time")}
+	}
+	if opts.SHA && opts.MergeCommit != "" {
+		return UsageError{errors.New("cannot specify --sha and --merge-commit at the same time")}
+	}
+	if opts.SHA && opts.Separate {
+		return UsageError{errors.New("cannot specify --sha and --separate at the same time")}
+	}
+	if opts.AutoResolve != "" && opts.AutoResolve != "trivial" {
+		return UsageError{fmt.Errorf("unknown --auto-resolve mode %q", opts.AutoResolve)}
+	}
+	if len(opts.Releases) > 0 && opts.Branch != "" {
+		return UsageError{errors.New("cannot specify --release and --branch at the same time")}
+	}
+	if opts.Cascade && opts.Branch != "" {
+		return UsageError{errors.New("cannot specify --cascade and --branch at the same time")}
+	}
+	if opts.Stack && !opts.Cascade {
+		return UsageError{errors.New("--stack may only be used with --cascade")}
+	}
+	if opts.Depth < 0 {
+		return UsageError{fmt.Errorf("invalid --depth %d", opts.Depth)}
+	}
+	if opts.Separate && (opts.Title != "" || opts.Body != "") {
+		return UsageError{errors.New("cannot specify --title, --body, or --body-file with --separate")}
+	}
+	if opts.Interactive && !isInteractive() {
+		return UsageError{errors.New("--interactive requires a terminal")}
+	}
+	if opts.Edit && !isInteractive() {
+		return UsageError{errors.New("--edit requires a terminal")}
+	}
+	if opts.Bundle != "" {
+		// The backport may run in another worktree.
+		var err error
+		if opts.Bundle, err = filepath.Abs(opts.Bundle); err != nil {
+			return fmt.Errorf("resolving --bundle path: %w", err)
+		}
+	}
+
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		// A shallow or filtered fetch would make a full clone shallow, or
+		// leave objects out of it, which a dry run must not do.
+		c.fetchDepth, c.fetchFilter = 0, ""
+	}
+
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if ok {
+		return errors.New("backport already in progress")
+	}
+
+	var prNos []int
+	var mergeCommit string
+	if opts.MergeCommit != "" {
+		mergeCommit, prNos, err = mergeCommitPRs(ctx, c, opts.MergeCommit)
+		if err != nil {
+			return err
+		}
+		infof("Note: %.10s merged %s.", mergeCommit, formatPRNumbers(prNos))
+	} else if !opts.SHA {
+		// With --sha, the arguments are commits, which are loaded below.
+		if prNos, err = parsePRArgs(c, prArgs); err != nil {
+			return err
+		}
+	}
+
+	pullRequests, err := loadPullRequests(ctx, c, prNos)
+	if err != nil {
+		return err
+	}
+	if opts.SHA {
+		raw, err := rawCommits(c, prArgs)
+		if err != nil {
+			return err
+		}
+		pullRequests = append(pullRequests, raw)
+	}
+	for _, pr := range pullRequests {
+		if mergeCommit != "" && pr.mergeCommit != mergeCommit {
+			warnf("PR #%d was merged by %.10s, not %.10s", pr.number, pr.mergeCommit, mergeCommit)
+		}
+	}
+
+	// PRs that target a release branch may be backported again to another
+	// release branch, e.g. from release-24.1 to release-23.2.
+	if !force {
+		re, err := releaseBranchRegexp()
+		if err != nil {
+			return err
+		}
+		for _, pr := range pullRequests {
+			if pr.baseBranch != "master" && !re.MatchString(pr.baseBranch) {
+				return fmt.Errorf("PR #%d targets %s, which is neither master nor a release branch",
+					pr.number, pr.baseBranch)
+			}
+		}
+	}
+
+	if err := checkUnmerged(pullRequests); err != nil {
+		return err
+	}
+
+	if err := pullRequests.selectCommits(opts.Commits); err != nil {
+		return err
+	}
+	if err := pullRequests.grepCommits(opts.Greps); err != nil {
+		return err
+	}
+
+	followUps, err := offerFollowUps(ctx, c, pullRequests)
+	if err != nil {
+		return err
+	}
+	if len(followUps) > 0 {
+		followUpPRs, err := loadPullRequests(ctx, c, followUps)
+		if err != nil {
+			return err
+		}
+		pullRequests = append(pullRequests, followUpPRs...)
+		prNos = append(prNos, followUps...)
+	}
+
+	if len(opts.Releases) == 0 && opts.Branch == "" {
+		opts.Releases, err = confirmLabeledReleases(pullRequests)
+		if err != nil {
+			return err
+		}
+	}
+
+	var destBranches []*destinationBranch
+	if opts.Cascade {
+		destBranches, err = cascadeBranches(ctx, c, opts.Releases)
+	} else {
+		destBranches, err = getDestinationBranches(ctx, c, opts.Releases, opts.Branch)
+	}
+	if err != nil {
+		return err
+	}
+	for _, destBranch := range destBranches {
+		if err := checkFreeze(destBranch); err != nil {
+			return err
+		}
+		if err := checkMinRelease(destBranch); err != nil {
+			return err
+		}
+		for _, pr := range pullRequests {
+			if pr.baseBranch == destBranch.branch && !force {
+				return fmt.Errorf("PR #%d already targets %s", pr.number, destBranch.branch)
+			}
+		}
+		err := checkDuplicateBackports(ctx, c, destBranch.branch, pullRequests, opts.CloseSuperseded)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Fetch master first, along with the release branches targeted by any of
+	// the PRs, so that the commits to cherry-pick are available locally. The
+	// destination branches are fetched just before they are checked out.
+	sourceBranches := []string{"master"}
+	fetched := map[string]bool{"master": true}
+	for _, pr := range pullRequests {
+		if !fetched[pr.baseBranch] {
+			fetched[pr.baseBranch] = true
+			sourceBranches = append(sourceBranches, pr.baseBranch)
+		}
+	}
+	// PRs that merged after the last prefetch are not in the prefetched
+	// branches yet.
+	if pullRequests.prefetched() {
+		err = fetchBranches(c, sourceBranches...)
+	} else {
+		err = fetchUpstream(c, sourceBranches...)
+	}
+	if err != nil {
+		return fmt.Errorf("fetching source branches: %w", err)
+	}
+	// A shallow fetch may leave out history that the backport needs: the
+	// history that the PRs landed in, and the parents of the commits to
+	// cherry-pick.
+	if err := deepenUntil(c, sourceBranches, pullRequests.haveMergeHistory); err != nil {
+		return err
+	}
+	if err := pullRequests.useLandedCommits(); err != nil {
+		return err
+	}
+	err = deepenUntil(c, sourceBranches, func() bool {
+		return haveParents(pullRequests.selectedCommits())
+	})
+	if err != nil {
+		return err
+	}
+	if err := checkReverted(pullRequests); err != nil {
+		return err
+	}
+	if opts.Interactive {
+		if err := pullRequests.pickCommits(); err != nil {
+			return err
+		}
+	}
+	if err := checkDangerousPaths(pullRequests.selectedCommits(), opts.DryRun); err != nil {
+		return err
+	}
+	var warnings map[string][]string
+	if !noVerify {
+		warnings, err = compatWarnings(ctx, c, destBranches, pullRequests.selectedCommits())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Approvers are only needed to request their reviews via the API.
+	if opts.CreatePR && c.authenticated && !opts.DryRun {
+		if err := pullRequests.loadApprovers(ctx, c); err != nil {
+			warnf("unable to look up approvers: %s", err)
+		}
+	}
+	if err := pullRequests.loadCoverage(ctx, c); err != nil {
+		warnf("unable to look up existing backports: %s", err)
+	}
+	pullRequests.printMergeSummaries()
+	c.releaseTeam = resolveReleaseTeam(ctx, c)
+	pending, err := planBackports(c, destBranches, pullRequests, warnings, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		for i, p := range pending {
+			if i > 0 {
+				renderer.Info("")
+			}
+			if err := printDryRun(pullRequests, p); err != nil {
+				return err
+			}
+		}
+		if !c.authenticated {
+			infof("\nNote: no GitHub token is configured. Creating the PR via the API\n" +
+				"(--create-pr or --draft), which also copies labels, requests reviews,\n" +
+				"sets the milestone, and comments on the source PRs, requires one.")
+		}
+		return nil
+	}
+	if !c.authenticated {
+		if opts.CreatePR {
+			return errTokenRequired("creating the PR via the API")
+		}
+		infof("Note: no GitHub token is configured, so the PR is left for you to open\n" +
+			"in your browser, and labels, reviewers, and the milestone are not set.")
+	}
+
+	if err := verifyFork(ctx, c); err != nil {
+		return err
+	}
+	err = runPending(ctx, c, pending)
+	if err == nil {
+		return nil
+	}
+
+	// If the cherry-pick conflicted, perhaps it's because the backport depends
+	// on earlier changes that were never backported. Raw commits cannot be
+	// combined with PRs, so the backport cannot be restarted with them.
+	if opts.SHA {
+		return err
+	}
+	prereqs, offerErr := offerPrerequisites(ctx, c, pullRequests)
+	if offerErr != nil {
+		warnf("unable to look for prerequisite PRs: %s", offerErr)
+	}
+	if len(prereqs) == 0 {
+		return err
+	}
+	backportBranch, err := capture("git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("looking up current branch name: %w", err)
+	}
+	if err := runAbort(ctx, false, false); err != nil {
+		return err
+	}
+	if err := spawn("git", "branch", "-D", backportBranch); err != nil {
+		return fmt.Errorf("deleting backport branch %q: %w", backportBranch, err)
+	}
+	var restartArgs []string
+	for _, prNo := range append(prereqs, prNos...) {
+		restartArgs = append(restartArgs, strconv.Itoa(prNo))
+	}
+	// The PRs of --merge-commit were resolved above, and are now given as
+	// arguments, which cannot be combined with it.
+	opts.MergeCommit, opts.SHA = "", false
+	return runBackport(ctx, restartArgs, opts)
+}
+
+// compareURL returns the URL of the GitHub page that opens a backport PR for
+// backportBranch with a pre-filled title and body.
+func compareURL(
+	c config, destBranch *destinationBranch, backportBranch string, title, body string,
+) string {
+	query := url.Values{}
+	query.Add("expand", "1")
+	query.Add("title", title)
+	query.Add("body", body)
+	return fmt.Sprintf("https://%s/%s/%s/compare/%s...%s?%s",
+		c.githubHost, c.upstreamOwner, c.upstreamRepo, destBranch.branch, c.compareHead(backportBranch), query.Encode())
+}
+
+// runContinue resumes the in-progress backport. If resolving the backport
+// required manual conflict resolution, a "Conflict resolution" section is added
+// to the PR body, containing the resolution notes if specified and otherwise
+// notes that the user is prompted for. The title and body overrides and Edit
+// in opts apply to the in-progress backport only, not to the queued ones.
+func runContinue(ctx context.Context, opts ContinueOptions) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no backport in progress")
+	}
+	summary.c = &c
+
+	// The queue holds the in-progress backport followed by the backports to
+	// other releases, if any. It is missing for adopted backports.
+	pending, err := loadQueue(c)
+	if err != nil {
+		return err
+	}
+	var current pendingBackport
+	if len(pending) > 0 {
+		current, pending = pending[0], pending[1:]
+	}
+	if current.Remote != "" || current.Depth != 0 || current.Filter != "" {
+		// Push to the remote, and fetch the way, chosen when the backport
+		// was started. Continue restores the overrides.
+		remoteOverride = current.Remote
+		depthOverride, filterOverride = current.Depth, current.Filter
+		if c, err = loadConfig(ctx); err != nil {
+			return err
+		}
+	}
+	if err := enterWorktree(current); err != nil {
+		return err
+	}
+	if err := useCommitter(current); err != nil {
+		return err
+	}
+
+	if ok, err := isCherryPicking(); err != nil {
+		return err
+	} else if ok {
+		err = spawn("git", "cherry-pick", "--continue")
+		if err != nil {
+			if err := recordConflict(c); err != nil {
+				return err
+			}
+			return err
+		}
+	}
+
+	in, err := ioutil.ReadFile(c.urlFile())
+	if err != nil {
+		return fmt.Errorf("reading url file: %w", err)
+	}
+	backportURL := string(in)
+
+	if opts.Title != "" || opts.Body != "" {
+		backportURL, err = setTitleAndBody(backportURL, opts.Title, opts.Body)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(c.urlFile(), []byte(backportURL), 0644); err != nil {
+			return fmt.Errorf("writing url file: %w", err)
+		}
+	}
+
+	if ok, err := hadConflicts(c); err != nil {
+		return err
+	} else if ok {
+		backportURL, err = addConflictResolution(backportURL, opts.Resolution)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(c.urlFile(), []byte(backportURL), 0644); err != nil {
+			return fmt.Errorf("writing url file: %w", err)
+		}
+		if err := os.Remove(c.conflictFile()); err != nil {
+			return fmt.Errorf("removing conflict file: %w", err)
+		}
+	}
+
+	current.URL = backportURL
+	current.DestBranch, current.BackportBranch, err = parseCompareURL(backportURL)
+	if err != nil {
+		return err
+	}
+	current.CreatePR = current.CreatePR || opts.CreatePR || opts.Draft
+	current.Draft = current.Draft || opts.Draft
+	current.Edit = current.Edit || opts.Edit
+	current.NoComment = current.NoComment || opts.NoComment
+
+	if err := finalize(ctx, c, current); err != nil {
+		return err
+	}
+	return runPending(ctx, c, pending)
+}
+
+// planBackports returns the backports of prs to each of destBranches. The
+// compatibility warnings in warnings, keyed by destination branch, are added
+// to the corresponding PR bodies.
+func planBackports(
+	c config,
+	destBranches []*destinationBranch,
+	prs pullRequests,
+	warnings map[string][]string,
+	opts Options,
+) ([]pendingBackport, error) {
+	// By default, all PRs are backported together. With --separate, each PR
+	// gets its own backport branch and PR.
+	groups := []pullRequests{prs}
+	if opts.Separate {
+		groups = nil
+		for _, pr := range prs.selectedPRs() {
+			groups = append(groups, pullRequests{pr})
+		}
+	}
+
+	tmpl, err := loadBodyTemplate()
+	if err != nil {
+		return nil, err
+	}
+	committer, err := resolveCommitter(opts.Committer)
+	if err != nil {
+		return nil, err
+	}
+
+	var origin string
+	if opts.Worktree {
+		if origin, err = capture("git", "rev-parse", "--show-toplevel"); err != nil {
+			return nil, fmt.Errorf("looking up the current worktree: %w", err)
+		}
+	}
+
+	// summaries maps each group to the title, sans branch, that the user gave
+	// it, to ask only once for all destination branches.
+	summaries := map[int]string{}
+
+	var pending []pendingBackport
+	// previous maps each group to its backport to the previous destination
+	// branch, for stacking.
+	previous := map[int]pendingBackport{}
+	for _, destBranch := range destBranches {
+		for i, group := range groups {
+			var groupPRNos []int
+			for _, pr := range group {
+				groupPRNos = append(groupPRNos, pr.number)
+			}
+			id := joinPRNumbers(groupPRNos, "-")
+			if group[0].isRaw() {
+				// Named after the first commit, like git describe does, rather
+				// than a PR number.
+				id = fmt.Sprintf("g%.10s", group.selectedCommits()[0])
+			}
+			backportBranch := fmt.Sprintf("backport%s-%s", destBranch.backportBranchSuffix, id)
+			if c.sharedFork {
+				backportBranch = c.login + "/" + backportBranch
+			}
+			title, body := group.title(destBranch), group.message(destBranch, c.releaseTeam)
+			if tmpl != nil {
+				body, err = group.templatedMessage(tmpl, destBranch, c.releaseTeam)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if opts.Title != "" {
+				title = opts.Title
+			} else if group.untitled() && isInteractive() && !opts.DryRun && !opts.Edit {
+				summary, ok := summaries[i]
+				if !ok {
+					if summary, err = group.promptTitle(destBranch); err != nil {
+						return nil, err
+					}
+					summaries[i] = summary
+				}
+				if summary != "" {
+					title = fmt.Sprintf("%s: %s", destBranch.branch, summary)
+				}
+			}
+			if opts.Body != "" {
+				body = opts.Body
+			}
+			// Templates place the justification themselves.
+			if destBranch.justification != "" && tmpl == nil {
+				body += fmt.Sprintf("\n### Backport to an unsupported release\n\n%s no longer accepts backports by default (backport.minRelease is %s). Justification:\n\n%s\n",
+					destBranch.branch, gitConfig("backport.minRelease"), destBranch.justification)
+			}
+			if checks := releaseChecklist(destBranch.branch); len(checks) > 0 {
+				body += fmt.Sprintf("\n### %s checklist\n\n", destBranch.branch)
+				for _, check := range checks {
+					body += fmt.Sprintf("- [ ] %s\n", check)
+				}
+			}
+			if ws := warnings[destBranch.branch]; len(ws) > 0 {
+				body += fmt.Sprintf("\n### Compatibility warnings\n\nThis change may rely on things that are missing from %s:\n\n",
+					destBranch.branch)
+				for _, w := range ws {
+					body += fmt.Sprintf("- %s\n", w)
+				}
+			}
+			p := pendingBackport{
+				DestBranch:      destBranch.branch,
+				BackportBranch:  backportBranch,
+				URL:             compareURL(c, destBranch, backportBranch, title, body),
+				Commits:         group.selectedCommits(),
+				CreatePR:        opts.CreatePR,
+				Draft:           opts.Draft,
+				AutoResolve:     opts.AutoResolve,
+				IgnoreSpace:     opts.IgnoreSpace,
+				RecordOrigin:    opts.RecordOrigin || gitConfigBool("backport.recordOrigin"),
+				CloseSuperseded: opts.CloseSuperseded,
+				NoComment:       opts.NoComment,
+				Remote:          opts.Remote,
+				Depth:           opts.Depth,
+				Filter:          opts.Filter,
+				Edit:            opts.Edit,
+				Bundle:          opts.Bundle,
+				Committer:       committer,
+			}
+			for _, pr := range group.selectedPRs() {
+				if !pr.isRaw() {
+					p.SourcePRs = append(p.SourcePRs, pr.number)
+				}
+			}
+			if p.Trailers, err = configuredTrailers(destBranch, group); err != nil {
+				return nil, err
+			}
+			if opts.Worktree {
+				p.Worktree, p.Origin = worktreePath(c, backportBranch), origin
+			}
+			if opts.Squash {
+				p.Squash = group.squashPlan()
+			}
+			labels, err := group.copiedLabels()
+			if err != nil {
+				return nil, err
+			}
+			if opts.LabelFromTitle {
+				if labels, err = group.addAreaLabels(labels); err != nil {
+					return nil, err
+				}
+			}
+			p.Labels = labels
+			p.Reviewers = group.reviewers(c.login)
+			if prev, ok := previous[i]; ok && opts.Stack {
+				p.StackOn, p.StackBase = prev.BackportBranch, prev.DestBranch
+			}
+			previous[i] = p
+			pending = append(pending, p)
+		}
+	}
+	return pending, nil
+}
+
+// releaseChecklist returns the items that reviewers of a backport to
+// destBranch should check off, e.g. the CI pipelines and platforms that still
+// matter for the release. They are configured with the multi-valued
+// backport.check option, for all branches, and backport.<branch>.check, e.g.
+// backport.release-23.1.check, for a single branch.
+func releaseChecklist(destBranch string) []string {
+	checks := gitConfigAll("backport.check")
+	return append(checks, gitConfigAll(fmt.Sprintf("backport.%s.check", destBranch))...)
+}
+
+// printDryRun describes the backport p of prs without performing it.
+func printDryRun(prs pullRequests, p pendingBackport) error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("malformatted backport url: %w", err)
+	}
+	infof("Would backport to %s on branch %s:", p.DestBranch, p.BackportBranch)
+	if p.StackOn != "" {
+		infof("\nStacked on the backport to %s; its commits are cherry-picked"+
+			"in place of these.\n", p.StackBase)
+	}
+	renderer.Info("\nCommits:")
+	inBackport := map[string]bool{}
+	for _, sha := range p.Commits {
+		inBackport[sha] = true
+	}
+	for _, pr := range prs.selectedPRs() {
+		for _, sha := range pr.selectedCommits {
+			if !inBackport[sha] {
+				continue
+			}
+			infof("    %s  %.10s  %s", pr.ref(), sha, pr.subject(sha))
+		}
+	}
+	infof("\nTitle: %s", u.Query().Get("title"))
+	renderer.Info("\nBody:")
+	for _, line := range strings.Split(u.Query().Get("body"), "\n") {
+		infof("    %s", line)
+	}
+	return nil
+}
+
+var compareURLRE = regexp.MustCompile(`/compare/(.+)\.\.\.[^:]+:(?:[^:/?]+:)?((?:[[:alnum:]\-]+/)?backport[^?]*)\?`)
+
+// parseCompareURL extracts the destination and backport branches from a URL
+// generated by compareURL.
+func parseCompareURL(backportURL string) (destBranch, backportBranch string, err error) {
+	matches := compareURLRE.FindStringSubmatch(backportURL)
+	if len(matches) == 0 {
+		return "", "", fmt.Errorf("malformatted url file: %s", backportURL)
+	}
+	return matches[1], matches[2], nil
+}
+
+// runAbort cancels the in-progress backport. By default, the entire
+// cherry-pick is rolled back. If keepBranch is set, the commits that were
+// successfully cherry-picked so far are kept on the backport branch. If stay is
+// set, only the in-progress cherry-pick is cancelled: the commits picked so far
+// and the backport state are kept, and the backport branch remains checked
+// out so that the backport can be completed by hand and resumed with
+// --continue.
+func runAbort(ctx context.Context, keepBranch, stay bool) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no backport in progress")
+	}
+
+	pending, err := loadQueue(c)
+	if err != nil {
+		return err
+	}
+	var current pendingBackport
+	if len(pending) > 0 {
+		current = pending[0]
+	}
+	if err := enterWorktree(current); err != nil {
+		return err
+	}
+
+	if !stay {
+		err = os.Remove(c.urlFile())
+		if err != nil {
+			return fmt.Errorf("removing url file: %w", err)
+		}
+		err = os.Remove(c.conflictFile())
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing conflict file: %w", err)
+		}
+		if err := saveQueue(c, nil); err != nil {
+			return err
+		}
+	}
+
+	if ok, err := isCherryPicking(); err != nil {
+		return err
+	} else if ok && (keepBranch || stay) {
+		// Forget about the remaining commits, then discard the conflicted
+		// changes from the commit that failed to apply.
+		if err := spawn("git", "cherry-pick", "--quit"); err != nil {
+			return err
+		}
+		if err := spawn("git", "reset", "--merge"); err != nil {
+			return err
+		}
+	} else if ok {
+		err = spawn("git", "cherry-pick", "--abort")
+		if err != nil {
+			return err
+		}
+	}
+
+	if stay {
+		return nil
+	}
+	if current.Worktree != "" {
+		return removeWorktree(current)
+	}
+	return checkoutPrevious()
+}
+
+// finalize pushes the backport branch for p and opens a PR for it, either
+// directly via the GitHub API or by launching a browser at the compare URL.
+func finalize(ctx context.Context, c config, p pendingBackport) error {
+	if p.CreatePR && !c.authenticated {
+		return errTokenRequired("creating the PR via the API")
+	}
+	if p.Edit {
+		edited, err := editMessage(c, p.URL)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(c.urlFile(), []byte(edited), 0644); err != nil {
+			return fmt.Errorf("writing url file: %w", err)
+		}
+		p.URL = edited
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("malformatted url file: %w", err)
+	}
+	title, body := u.Query().Get("title"), u.Query().Get("body")
+
+	if len(p.Squash) > 0 {
+		if err := squashCommits(c, p); err != nil {
+			return err
+		}
+	}
+	if len(p.Trailers) > 0 {
+		if err := addTrailers(c, p); err != nil {
+			return err
+		}
+	}
+
+	if !noVerify {
+		if err := lintPR(title, body); err != nil {
+			return err
+		}
+	}
+
+	err = spawn("git", "push", "-u", whenForced("--force", "--no-force"),
+		c.remote, fmt.Sprintf("%[1]s:%[1]s", p.BackportBranch))
+	if err != nil {
+		return fmt.Errorf("pushing branch: %w", err)
+	}
+
+	var prURL string
+	var reviewers []string
+	if p.CreatePR {
+		pr, err := createPullRequest(ctx, c, p.BackportBranch, github.NewPullRequest{
+			Title: github.String(title),
+			Base:  github.String(p.DestBranch),
+			Body:  github.String(body),
+			Draft: github.Bool(p.Draft),
+		})
+		if err != nil {
+			return hintedErr{
+				error: fmt.Errorf("creating PR: %w", err),
+				hint: fmt.Sprintf(`the backport branch was pushed. Run 'backport --continue' to retry,
+or submit the PR manually at:
+
+    %s`, p.URL),
+			}
+		}
+		infof("Created backport PR: %s", pr.GetHTMLURL())
+		prURL = pr.GetHTMLURL()
+		if labels := existingLabels(ctx, c, p.Labels); len(labels) > 0 {
+			_, _, err := c.ghClient.Issues.AddLabelsToIssue(ctx, c.upstreamOwner, c.upstreamRepo,
+				pr.GetNumber(), labels)
+			if err != nil {
+				warnf("unable to copy labels to #%d: %s", pr.GetNumber(), err)
+			}
+		}
+		reviewers = requestReviews(ctx, c, pr.GetNumber(), p.Reviewers)
+		if milestone, err := findMilestone(ctx, c, p.DestBranch); err != nil {
+			warnf("unable to set milestone on #%d: %s", pr.GetNumber(), err)
+		} else if milestone != 0 {
+			_, _, err := c.ghClient.Issues.Edit(ctx, c.upstreamOwner, c.upstreamRepo, pr.GetNumber(),
+				&github.IssueRequest{Milestone: github.Int(milestone)})
+			if err != nil {
+				warnf("unable to set milestone on #%d: %s", pr.GetNumber(), err)
+			}
+		}
+		if ciMode {
+			ciCreated.urls = append(ciCreated.urls, pr.GetHTMLURL())
+			ciCreated.branches = append(ciCreated.branches, p.BackportBranch)
+		}
+
+		if !p.NoComment {
+			comment := fmt.Sprintf("Backported to %s in #%d.", p.DestBranch, pr.GetNumber())
+			for _, prNo := range p.SourcePRs {
+				_, _, err := c.ghClient.Issues.CreateComment(ctx, c.upstreamOwner, c.upstreamRepo, prNo,
+					&github.IssueComment{Body: github.String(comment)})
+				if err != nil {
+					warnf("unable to comment on #%d: %s", prNo, err)
+				}
+			}
+		}
+
+		if p.CloseSuperseded {
+			if err := closeSuperseded(ctx, c, pr); err != nil {
+				warnf("unable to close superseded backport PRs: %s", err)
+			}
+		}
+	}
+
+	err = os.Remove(c.urlFile())
+	if err != nil {
+		return fmt.Errorf("removing url file: %w", err)
+	}
+
+	if !p.CreatePR {
+		err = spawn(browserCmd(p.URL)...)
+		if err != nil {
+			warnf("unable to launch web browser: %s\nSubmit PR manually at:\n    %s", err, p.URL)
+		}
+	}
+
+	done := finished{destBranch: p.DestBranch, backportBranch: p.BackportBranch}
+	if p.CreatePR {
+		done.prURL, done.reviewers = prURL, reviewers
+	}
+	summary.finished = append(summary.finished, done)
+
+	if p.Worktree != "" {
+		return removeWorktree(p)
+	}
+	return checkoutPrevious()
+}
+
+// recordConflict notes that the in-progress backport required manual conflict
+// resolution.
+func recordConflict(c config) error {
+	if err := ioutil.WriteFile(c.conflictFile(), nil, 0644); err != nil {
+		return fmt.Errorf("writing conflict file: %w", err)
+	}
+	return nil
+}
+
+func hadConflicts(c config) (bool, error) {
+	_, err := os.Stat(c.conflictFile())
+	if err == nil {
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("checking for conflicts: %w", err)
+	}
+	return false, nil
+}
+
+// setTitleAndBody replaces the title and body in backportURL with title and
+// body, unless they are empty.
+func setTitleAndBody(backportURL, title, body string) (string, error) {
+	u, err := url.Parse(backportURL)
+	if err != nil {
+		return "", fmt.Errorf("malformatted url file: %w", err)
+	}
+	query := u.Query()
+	if title != "" {
+		query.Set("title", title)
+	}
+	if body != "" {
+		query.Set("body", body)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// addConflictResolution appends a "Conflict resolution" section to the body
+// in backportURL. If resolution is empty and stdin is a terminal, the user is
+// prompted for it.
+func addConflictResolution(backportURL, resolution string) (string, error) {
+	if resolution == "" && isInteractive() {
+		var err error
+		resolution, err = prompt("Briefly describe how the cherry-pick conflicts were resolved:\n> ")
+		if err != nil {
+			return "", err
+		}
+	}
+	if resolution == "" {
+		resolution = "Conflicts were resolved manually."
+	}
+	u, err := url.Parse(backportURL)
+	if err != nil {
+		return "", fmt.Errorf("malformatted url file: %w", err)
+	}
+	query := u.Query()
+	body := strings.TrimRight(query.Get("body"), "\n")
+	query.Set("body", fmt.Sprintf("%s\n\n### Conflict resolution\n\n%s\n", body, resolution))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// isCherryPicking reports whether a cherry-pick is in progress in the current
+// worktree.
+func isCherryPicking() (bool, error) {
+	path, err := capture("git", "rev-parse", "--git-path", "CHERRY_PICK_HEAD")
+	if err != nil {
+		return false, fmt.Errorf("checking for in-progress cherry-pick: %w", err)
+	}
+	_, err = os.Stat(path)
+	if err == nil {
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("checking for in-progress cherry-pick: %w", err)
+	}
+	return false, nil
+}
+
+func isBackporting(c config) (bool, error) {
+	_, err := os.Stat(c.urlFile())
+	if err == nil {
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("checking for in-progress backport: %w", err)
+	}
+	return false, nil
+}
+
+func checkoutPrevious() error {
+	branch, err := capture("git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("looking up current branch name: %w", err)
+	}
+	if !backportBranchRE.MatchString(branch) {
+		return nil
+	}
+	if err := spawn("git", "checkout", whenForced("--force", "--no-force"), "-"); err != nil {
+		return fmt.Errorf("returning to previous branch: %w", err)
+	}
+	return nil
+}
+
+// defaultRequestTimeout bounds each individual GitHub API request, unless
+// overridden by backport.requestTimeout.
+const defaultRequestTimeout = 30 * time.Second
+
+type config struct {
+	ghClient      *github.Client
+	remote        string
+	username      string // the owner of the fork
+	forkRepo      string // the name of the user's fork
+	login         string // the GitHub user running backport
+	sharedFork    bool   // whether the fork is shared by several users
+	authenticated bool   // whether a GitHub token is configured
+	gitDir        string
+	upstreamOwner string
+	upstreamRepo  string
+	githubHost    string // github.com, or the GitHub Enterprise Server host
+
+	// upstreamRemote is the promisor remote of a partial clone that fetches
+	// from upstream, if any, which fetches go through to apply its filter.
+	upstreamRemote string
+
+	fetchDepth  int    // how many commits of each branch to fetch, or 0 for all
+	fetchFilter string // the object filter to fetch with, e.g. blob:none
+
+	releaseTeam string // the team that PR bodies mention, once resolved
+}
+
+func loadConfig(ctx context.Context) (config, error) {
+	var c config
+
+	// Determine remote. backport.pushURL, if set, names the URL to push to
+	// directly, e.g. an SSH URL for a fork that is reachable only via SSH.
+	// backport.sharedFork, if set, names the remote of a fork shared by the
+	// release team, which takes precedence. --remote overrides all of these.
+	pushURL := gitConfig("backport.pushURL")
+	sharedFork := gitConfig("backport.sharedFork")
+	c.remote = pushURL
+	if remoteOverride != "" {
+		c.remote, pushURL = remoteOverride, ""
+	} else if sharedFork != "" {
+		c.remote, pushURL = sharedFork, ""
+	} else if c.remote == "" {
+		c.remote = gitConfig("cockroach.remote")
+	}
+	if c.remote == "" {
+		return c, hintedErr{
+			error: errors.New("missing cockroach.remote configuration"),
+			hint: `set cockroach.remote to the name of the Git remote to push
+backports to. For example:
+
+    $ git config cockroach.remote origin
+`,
+		}
+	}
+
+	githubAPI := gitConfig("backport.githubAPI")
+	var err error
+	if c.githubHost, err = githubHost(); err != nil {
+		return c, err
+	}
+
+	// Build GitHub client.
+	requestTimeout := defaultRequestTimeout
+	if s := gitConfig("backport.requestTimeout"); s != "" {
+		requestTimeout, err = time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("parsing backport.requestTimeout: %w", err)
+		}
+	}
+	cacheTTL := defaultCacheTTL
+	if s := gitConfig("backport.cacheTTL"); s != "" {
+		cacheTTL, err = time.ParseDuration(s)
+		if err != nil {
+			return c, fmt.Errorf("parsing backport.cacheTTL: %w", err)
+		}
+	}
+	ghAuthClient := &http.Client{}
+	ghToken := githubToken(c.githubHost)
+	if ghToken != "" {
+		ghAuthClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(
+			&oauth2.Token{AccessToken: ghToken}))
+		c.authenticated = true
+		// Listing the branches of a big repository takes many requests, so
+		// cache those like the unauthenticated requests below.
+		ghAuthClient.Transport = newCachingTransport(ghAuthClient.Transport, ghToken, cacheTTL,
+			branchListPathRE, branchListPathRE)
+	} else {
+		// Unauthenticated requests are rate limited heavily, so cache them,
+		// revalidating all but the branch listing.
+		ghAuthClient.Transport = newCachingTransport(http.DefaultTransport, "", cacheTTL,
+			nil, branchListPathRE)
+	}
+	ghAuthClient.Transport = newRetryTransport(ghAuthClient.Transport, requestTimeout)
+	if githubAPI != "" {
+		uploadURL := gitConfig("backport.githubUpload")
+		if uploadURL == "" {
+			uploadURL = strings.Replace(githubAPI, "/api/v3", "/api/uploads", 1)
+		}
+		c.ghClient, err = github.NewEnterpriseClient(githubAPI, uploadURL, ghAuthClient)
+		if err != nil {
+			return c, fmt.Errorf("creating GitHub Enterprise client: %w", err)
+		}
+	} else {
+		c.ghClient = github.NewClient(ghAuthClient)
+	}
+
+	// Determine username. The push URL need not name the GitHub host, e.g.
+	// when it uses an SSH host alias, so the owner and repository are taken
+	// from the end of the URL if need be, and backport.forkOwner overrides
+	// the owner altogether.
+	remoteURL := c.remote
+	if pushURL == "" {
+		remoteURL, err = capture("git", "remote", "get-url", "--push", c.remote)
+		if err != nil {
+			return c, fmt.Errorf("determining URL for remote %q: %w", c.remote, err)
+		}
+	}
+	m := regexp.MustCompile(regexp.QuoteMeta(c.githubHost) +
+		`(:|/)([[:alnum:]\-]+)(?:/([[:alnum:]._\-]+?)(?:\.git)?/?$)?`).FindStringSubmatch(remoteURL)
+	if m == nil {
+		m = regexp.MustCompile(`(:|/)([[:alnum:]\-]+)/([[:alnum:]._\-]+?)(?:\.git)?/?$`).FindStringSubmatch(remoteURL)
+	}
+	owner := gitConfig("backport.forkOwner")
+	if m == nil && owner == "" && ghToken != "" {
+		// Ask GitHub whose token this is instead.
+		user, _, err := c.ghClient.Users.Get(ctx, "")
+		if err != nil {
+			return c, fmt.Errorf("unable to guess GitHub username from remote %q (%s), or look it up: %w",
+				c.remote, remoteURL, err)
+		}
+		owner = user.GetLogin()
+	}
+	if owner != "" {
+		if m == nil {
+			m = make([]string, 4)
+		}
+		m[2] = owner
+	}
+	if len(m) != 4 {
+		return c, hintedErr{
+			error: fmt.Errorf("unable to guess GitHub username from remote %q (%s)", c.remote, remoteURL),
+			hint: `name the owner of your fork with:
+
+    $ git config backport.forkOwner USERNAME
+`,
+		}
+	}
+	c.username = m[2]
+
+	// Determine who is running backport. Backport branches in a shared fork
+	// are namespaced by the login of their author.
+	c.login = c.username
+	if sharedFork != "" && c.remote == sharedFork {
+		c.sharedFork = true
+		c.login = gitConfig("github.user")
+		if c.login == "" && ghToken != "" {
+			user, _, err := c.ghClient.Users.Get(ctx, "")
+			if err != nil {
+				return c, fmt.Errorf("looking up GitHub username: %w", err)
+			}
+			c.login = user.GetLogin()
+		}
+		if c.login == "" {
+			return c, hintedErr{
+				error: errors.New("unable to determine GitHub username for shared fork"),
+				hint: `name yourself with:
+
+    $ git config github.user USERNAME
+`,
+			}
+		}
+	}
+
+	// Determine upstream repository. Unless configured otherwise, assume the
+	// fork has the same name as the cockroachdb repository it was forked from.
+	if upstream := gitConfig("backport.upstream"); upstream != "" {
+		parts := strings.Split(upstream, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return c, fmt.Errorf("backport.upstream must be of the form OWNER/REPO, not %q", upstream)
+		}
+		c.upstreamOwner, c.upstreamRepo = parts[0], parts[1]
+	} else {
+		c.upstreamOwner, c.upstreamRepo = "cockroachdb", m[3]
+		if c.upstreamRepo == "" {
+			c.upstreamRepo = "cockroach"
+		}
+	}
+	if strings.EqualFold(c.username, c.upstreamOwner) {
+		return c, fmt.Errorf("refusing to use unforked remote %q (%s)",
+			c.remote, remoteURL)
+	}
+	c.forkRepo = m[3]
+	if c.forkRepo == "" {
+		c.forkRepo = c.upstreamRepo
+	}
+	c.upstreamRemote = findUpstreamPromisor(c)
+
+	// Determine how much to fetch. Shallow and blobless fetches suit CI jobs,
+	// which start from a fresh clone every time.
+	c.fetchDepth, c.fetchFilter = depthOverride, filterOverride
+	if s := gitConfig("backport.fetchDepth"); s != "" && c.fetchDepth == 0 {
+		if c.fetchDepth, err = parseFetchDepth(s); err != nil {
+			return c, fmt.Errorf("parsing backport.fetchDepth: %w", err)
+		}
+	}
+	if c.fetchFilter == "" {
+		c.fetchFilter = gitConfig("backport.fetchFilter")
+	}
+
+	// Determine Git directory. The backport state is stored in the common
+	// directory, so that it is shared by all worktrees.
+	c.gitDir, err = capture("git", "rev-parse", "--git-common-dir")
+	if err != nil {
+		return c, fmt.Errorf("looking up git directory: %w", err)
+	}
+	c.gitDir, err = filepath.Abs(c.gitDir)
+	if err != nil {
+		return c, fmt.Errorf("looking up git directory: %w", err)
+	}
+
+	return c, nil
+}
+
+// upstreamURL returns the URL from which to fetch the upstream repository, or,
+// in a partial clone, the promisor remote that fetches from it.
+func (c config) upstreamURL() string {
+	if c.upstreamRemote != "" {
+		return c.upstreamRemote
+	}
+	return fmt.Sprintf("https://%s/%s/%s.git", c.githubHost, c.upstreamOwner, c.upstreamRepo)
+}
+
+func (c config) urlFile() string {
+	return filepath.Join(c.gitDir, "BACKPORT_URL")
+}
+
+func (c config) conflictFile() string {
+	return filepath.Join(c.gitDir, "BACKPORT_CONFLICTS")
+}
+
+// gitConfig returns the value of the specified configuration option, or the
+// empty string if the option is not set. Options set in Git's configuration
+// take precedence over those in .backportrc and the global configuration file.
+func gitConfig(key string) string {
+	return lookupConfig(key, "--get")
+}
+
+// gitConfigAll returns all values of the specified multi-valued Git
+// configuration option.
+func gitConfigAll(key string) []string {
+	v := lookupConfig(key, "--get-all")
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, "\n")
+}
+
+// gitConfigBool is like gitConfig, but interprets the option as a boolean
+// using Git's rules. Unset options are false.
+func gitConfigBool(key string) bool {
+	return lookupConfig(key, "--bool", "--get") == "true"
+}
+
+// defaultReleaseBranchPattern matches the branches considered release branches
+// unless overridden by backport.releaseBranchPattern.
+const defaultReleaseBranchPattern = `^release-`
+
+// listReleaseBranches returns the names of the upstream release branches, from
+// oldest to newest. Release branches are those whose names match the regular
+// expression in backport.releaseBranchPattern, e.g.
+// `^(release-\d+\.\d+(\.\d+)?|provisional_\d+)$`.
+func listReleaseBranches(ctx context.Context, c config) ([]string, error) {
+	re, err := releaseBranchRegexp()
+	if err != nil {
+		return nil, err
+	}
+
+	opt := &github.BranchListOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var allBranches []*github.Branch
+	for {
+		branches, res, err := c.ghClient.Repositories.ListBranches(ctx, c.upstreamOwner, c.upstreamRepo, opt)
+		if err != nil {
+			return nil, fmt.Errorf("discovering release branches: %w", err)
+		}
+		allBranches = append(allBranches, branches...)
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	var releaseBranches []string
+	for _, branch := range allBranches {
+		if !re.MatchString(branch.GetName()) {
+			continue
+		}
+		releaseBranches = append(releaseBranches, branch.GetName())
+	}
+	// GitHub lists branches lexicographically, which puts release-19.1 before
+	// release-2.1.
+	sort.SliceStable(releaseBranches, func(i, j int) bool {
+		return branchVersionLess(releaseBranches[i], releaseBranches[j])
+	})
+	return releaseBranches, nil
+}
+
+var branchVersionRE = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?(.*)$`)
+
+// parseBranchVersion parses the version in a release branch name, e.g. 23 and
+// 1 for release-23.1, or 23, 1, and 10 with the suffix "-rc" for
+// release-23.1.10-rc. The patch version is -1 for branches of a whole
+// release series.
+func parseBranchVersion(branch string) (major, minor, patch int, suffix string, ok bool) {
+	m := branchVersionRE.FindStringSubmatch(branch)
+	if m == nil {
+		return 0, 0, 0, "", false
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	patch = -1
+	if m[3] != "" {
+		patch, _ = strconv.Atoi(m[3])
+	}
+	return major, minor, patch, m[4], true
+}
+
+// isSeriesBranch reports whether branch is the release branch of a whole
+// release series, like release-23.1, rather than of a point release, like
+// release-23.1.10-rc, or a branch without a version.
+func isSeriesBranch(branch string) bool {
+	_, _, patch, suffix, ok := parseBranchVersion(branch)
+	return ok && patch < 0 && suffix == ""
+}
+
+// branchVersionLess orders release branches by version. Branches without a
+// version come first, and a release series comes before its point releases.
+func branchVersionLess(a, b string) bool {
+	aMajor, aMinor, aPatch, aSuffix, aOK := parseBranchVersion(a)
+	bMajor, bMinor, bPatch, bSuffix, bOK := parseBranchVersion(b)
+	switch {
+	case !aOK || !bOK:
+		return !aOK && bOK
+	case aMajor != bMajor:
+		return aMajor < bMajor
+	case aMinor != bMinor:
+		return aMinor < bMinor
+	case aPatch != bPatch:
+		return aPatch < bPatch
+	default:
+		return aSuffix < bSuffix
+	}
+}
+
+// seriesBranches returns the release branches of whole release series among
+// branches, in order. If there are none, e.g. because release branches are
+// not named after versions, all of branches are returned.
+func seriesBranches(branches []string) []string {
+	var series []string
+	for _, branch := range branches {
+		if isSeriesBranch(branch) {
+			series = append(series, branch)
+		}
+	}
+	if len(series) == 0 {
+		return branches
+	}
+	return series
+}
+
+// releaseBranchRegexp returns the regular expression that matches the names of
+// release branches.
+func releaseBranchRegexp() (*regexp.Regexp, error) {
+	pattern := gitConfig("backport.releaseBranchPattern")
+	if pattern == "" {
+		pattern = defaultReleaseBranchPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("parsing backport.releaseBranchPattern: %w", err)
+	}
+	return re, nil
+}
+
+// resolveRelease maps a --release argument to the name of a release branch.
+// Aliases configured via backport.alias.<name> take precedence; otherwise the
+// empty string and "stable" select the newest release branch and "prev"
+// selects the one before it. Anything else names a release or a branch, as
+// interpreted by releaseBranchName.
+func resolveRelease(ctx context.Context, c config, releaseArg string) (string, error) {
+	if releaseArg != "" {
+		if release := gitConfig("backport.alias." + releaseArg); release != "" {
+			return releaseBranchName(release), nil
+		}
+	}
+
+	var offset int
+	switch releaseArg {
+	case "", "stable":
+		offset = 1
+	case "prev":
+		offset = 2
+	case "lts":
+		return "", hintedErr{
+			error: errors.New("release alias \"lts\" is not configured"),
+			hint: `map the lts alias to a release with:
+
+    $ git config backport.alias.lts 23.1
+`,
+		}
+	default:
+		return releaseBranchName(releaseArg), nil
+	}
+
+	releaseBranches, err := listReleaseBranches(ctx, c)
+	if err != nil {
+		return "", err
+	}
+	releaseBranches = seriesBranches(releaseBranches)
+	if gitConfigBool("backport.skipUnreleased") {
+		releaseBranches, err = trimUnreleased(c, releaseBranches)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(releaseBranches) < offset {
+		return "", errors.New("unable to determine latest release; try specifying --release")
+	}
+	return releaseBranches[len(releaseBranches)-offset], nil
+}
+
+var (
+	releaseVersionRE = regexp.MustCompile(`(\d+\.\d+)`)
+	bareReleaseRE    = regexp.MustCompile(`^\d+\.\d+(\.\d+)?(-\S+)?$`)
+)
+
+// releaseBranchName returns the branch for a release such as 23.1 or
+// 23.1.12-rc, which is release-23.1 or release-23.1.12-rc. Anything else,
+// e.g. staging-v23.1.12, is taken to be the name of the branch already.
+func releaseBranchName(release string) string {
+	if bareReleaseRE.MatchString(release) {
+		return "release-" + release
+	}
+	return release
+}
+
+// trimUnreleased drops the newest release branches that do not yet have a
+// published (i.e., non-prerelease) vX.Y.Z tag upstream. A freshly cut release
+// branch is not usually the right default backport target until its first
+// release.
+func trimUnreleased(c config, releaseBranches []string) ([]string, error) {
+	out, err := capture("git", "ls-remote", "--tags", "--refs", c.upstreamURL(), "refs/tags/v*")
+	if err != nil {
+		return nil, fmt.Errorf("listing upstream tags: %w", err)
+	}
+	published := map[string]bool{}
+	tagRE := regexp.MustCompile(`refs/tags/v(\d+\.\d+)\.\d+$`)
+	for _, line := range strings.Split(out, "\n") {
+		if m := tagRE.FindStringSubmatch(line); m != nil {
+			published[m[1]] = true
+		}
+	}
+	for len(releaseBranches) > 0 {
+		m := releaseVersionRE.FindStringSubmatch(releaseBranches[len(releaseBranches)-1])
+		if m != nil && published[m[1]] {
+			break
+		}
+		releaseBranches = releaseBranches[:len(releaseBranches)-1]
+	}
+	return releaseBranches, nil
+}
+
+type destinationBranch struct {
+	branch               string // either `release-{major-series}` or `{branch}`, derived from command-line parameter
+	backportBranchSuffix string // suffix to add to the backport branch, derived from the source branch
+	justification        string // why a release that no longer accepts backports is targeted anyway
+}
+
+// newDestinationBranch returns the destinationBranch for the named upstream
+// branch. The conventional "release-" prefix is omitted from the backport
+// branch name, so that backporting to release-23.2.5 yields a backport branch
+// named backport23.2.5-NNNN.
+func newDestinationBranch(branch string) *destinationBranch {
+	return &destinationBranch{
+		branch:               branch,
+		backportBranchSuffix: strings.TrimPrefix(branch, "release-"),
+	}
+}
+
+// isForwardPort returns whether destBranch is master, i.e., whether changes
+// that landed on a release branch first, like hotfixes, are being ported
+// forward rather than backported.
+func (destBranch *destinationBranch) isForwardPort() bool {
+	return destBranch.branch == "master"
+}
+
+// getDestinationBranches returns the branches to backport to. If neither
+// releases nor a branch are specified, the latest release is used.
+func getDestinationBranches(
+	ctx context.Context, c config, releaseArgs []string, branchArg string,
+) ([]*destinationBranch, error) {
+	if branchArg != "" {
+		return []*destinationBranch{newDestinationBranch(branchArg)}, nil
+	}
+	if len(releaseArgs) == 0 {
+		releaseArgs = []string{""}
+	}
+	var destBranches []*destinationBranch
+	seen := map[string]bool{}
+	for _, releaseArg := range releaseArgs {
+		releaseBranch, err := resolveRelease(ctx, c, releaseArg)
+		if err != nil {
+			return nil, err
+		}
+		if seen[releaseBranch] {
+			continue
+		}
+		seen[releaseBranch] = true
+		destBranches = append(destBranches, newDestinationBranch(releaseBranch))
+	}
+	return destBranches, nil
+}
+
+var (
+	prRefRE = regexp.MustCompile(`^([^/#\s]+/[^/#\s]+)#(\d+)$`)
+	prNoRE  = regexp.MustCompile(`^#?(\d+)$`)
+)
+
+// parsePRArgs parses pull request arguments of the forms 12345, #12345,
+// OWNER/REPO#12345, and https://github.com/OWNER/REPO/pull/12345, where
+// OWNER/REPO must be the upstream repository. Duplicate PRs are dropped. All
+// invalid arguments are reported at once.
+func parsePRArgs(c config, prArgs []string) ([]int, error) {
+	upstream := c.upstreamOwner + "/" + c.upstreamRepo
+	prURLRE := regexp.MustCompile(`^https?://` + regexp.QuoteMeta(c.githubHost) +
+		`/([^/]+/[^/]+)/pull/(\d+)(?:[/?#].*)?$`)
+	var prNos []int
+	var problems []string
+	seen := map[int]bool{}
+	for i, prArg := range prArgs {
+		var repo, num string
+		if m := prURLRE.FindStringSubmatch(prArg); m != nil {
+			repo, num = m[1], m[2]
+		} else if m := prRefRE.FindStringSubmatch(prArg); m != nil {
+			repo, num = m[1], m[2]
+		} else if m := prNoRE.FindStringSubmatch(prArg); m != nil {
+			num = m[1]
+		} else {
+			problems = append(problems, fmt.Sprintf("argument %d: %q is not a pull request number or URL", i+1, prArg))
+			continue
+		}
+		if repo != "" && !strings.EqualFold(repo, upstream) {
+			problems = append(problems, fmt.Sprintf("argument %d: %q does not refer to %s", i+1, prArg, upstream))
+			continue
+		}
+		prNo, err := strconv.Atoi(num)
+		if err != nil || prNo == 0 {
+			problems = append(problems, fmt.Sprintf("argument %d: %q is not a valid pull request number", i+1, prArg))
+			continue
+		}
+		if seen[prNo] {
+			continue
+		}
+		seen[prNo] = true
+		prNos = append(prNos, prNo)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid pull request arguments:\n    %s", strings.Join(problems, "\n    "))
+	}
+	return prNos, nil
+}
+
+// joinPRNumbers formats prNos as decimal numbers separated by sep.
+func joinPRNumbers(prNos []int, sep string) string {
+	strs := make([]string, len(prNos))
+	for i, prNo := range prNos {
+		strs[i] = strconv.Itoa(prNo)
+	}
+	return strings.Join(strs, sep)
+}
+
+type pullRequest struct {
+	number          int
+	title           string
+	body            string
+	commits         []string
+	messages        map[string]string // commit SHA -> commit message
+	selectedCommits []string
+	baseBranch      string
+	mergeCommit     string // SHA of the merge commit on the base branch, if merged
+	labels          []string
+	author          string
+	approvers       []string // set by loadApprovers
+	squashed        bool     // whether the PR was squash-merged
+	mergedAt        time.Time
+	coverage        []backportCoverage // set by loadCoverage
+}
+
+type pullRequests []pullRequest
+
+// loadConcurrency bounds how many PRs loadPullRequests fetches at once.
+const loadConcurrency = 8
+
+// loadPullRequests fetches the given PRs, in order. With a token, they are
+// fetched in one go with the GraphQL API, which requires one, and otherwise
+// concurrently with the REST API. If several PRs cannot be fetched, the
+// errors are combined.
+func loadPullRequests(ctx context.Context, c config, prNos []int) (pullRequests, error) {
+	if c.authenticated {
+		return loadPullRequestsGraphQL(ctx, c, prNos)
+	}
+	prs := make(pullRequests, len(prNos))
+	errs := make([]error, len(prNos))
+	sem := make(chan struct{}, loadConcurrency)
+	var wg sync.WaitGroup
+	for i, prNo := range prNos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, prNo int) {
+			defer func() { <-sem; wg.Done() }()
+			prs[i], errs[i] = loadPullRequest(ctx, c, prNo)
+		}(i, prNo)
+	}
+	wg.Wait()
+
+	var first error
+	var rest []string
+	for _, err := range errs {
+		if err == nil {
+			continue
+		} else if first == nil {
+			first = err
+		} else {
+			rest = append(rest, err.Error())
+		}
+	}
+	if first == nil {
+		return prs, nil
+	} else if len(rest) > 0 {
+		// Keep the first error wrapped, e.g. so that rate limits are recognized.
+		return nil, fmt.Errorf("%w; %s", first, strings.Join(rest, "; "))
+	}
+	return nil, first
+}
+
+// loadPullRequest fetches a PR and its commits with the REST API.
+func loadPullRequest(ctx context.Context, c config, prNo int) (pullRequest, error) {
+	ghPR, _, err := c.ghClient.PullRequests.Get(ctx, c.upstreamOwner, c.upstreamRepo, prNo)
+	if err != nil {
+		return pullRequest{}, fmt.Errorf("fetching PR #%d: %w", prNo, err)
+	}
+	commits, _, err := c.ghClient.PullRequests.ListCommits(ctx, c.upstreamOwner, c.upstreamRepo, prNo, nil)
+	if err != nil {
+		return pullRequest{}, fmt.Errorf("fetching commits from PR #%d: %w", prNo, err)
+	}
+	pr := pullRequest{
+		number:     prNo,
+		title:      ghPR.GetTitle(),
+		body:       ghPR.GetBody(),
+		baseBranch: ghPR.GetBase().GetRef(),
+		author:     ghPR.GetUser().GetLogin(),
+		messages:   map[string]string{},
+	}
+	if ghPR.GetMerged() {
+		pr.mergeCommit = ghPR.GetMergeCommitSHA()
+		pr.mergedAt = ghPR.GetMergedAt()
+	}
+	for _, l := range ghPR.Labels {
+		pr.labels = append(pr.labels, l.GetName())
+	}
+	for _, c := range commits {
+		pr.commits = append(pr.commits, c.GetSHA())
+		pr.messages[c.GetSHA()] = c.GetCommit().GetMessage()
+		pr.selectedCommits = append(pr.selectedCommits, c.GetSHA())
+	}
+	return pr, nil
+}
+
+// useLandedCommits replaces the commits of each merged PR by the commits that
+// actually landed, as determined by landedCommits. The PR's own commit listing
+// can include commits that were dropped when the PR was rebased, and merge
+// queues may land rewritten copies of the PR's commits. Commits that were
+// explicitly selected but did not land are dropped with a warning. Master
+// must have just been fetched into FETCH_HEAD.
+func (prs pullRequests) useLandedCommits() error {
+	for i := range prs {
+		pr := &prs[i]
+		if pr.mergeCommit == "" {
+			continue
+		}
+		landed, origin, err := pr.landedCommits()
+		if err != nil {
+			return err
+		}
+		if len(landed) == 0 {
+			continue
+		}
+		if pr.squashed && len(pr.selectedCommits) != len(pr.commits) {
+			if !force {
+				return hintedErr{
+					error: fmt.Errorf("PR #%d was squash-merged, so its commits cannot be backported individually", pr.number),
+					hint: `only the squashed commit landed on master. Backport the whole PR, or
+rerun with --force to cherry-pick the selected commits from the PR branch
+anyway.`,
+				}
+			}
+			continue
+		}
+
+		listed := map[string]bool{}
+		for _, sha := range pr.commits {
+			listed[sha] = true
+		}
+		selected := map[string]bool{}
+		for _, sha := range pr.selectedCommits {
+			selected[sha] = true
+		}
+		allSelected := len(pr.selectedCommits) == len(pr.commits)
+
+		var selectedCommits []string
+		differs := len(landed) != len(pr.commits)
+		for _, sha := range landed {
+			if !listed[sha] {
+				differs = true
+				msg, err := capture("git", "log", "-n1", "--format=%B", sha)
+				if err != nil {
+					return fmt.Errorf("reading message of commit %s: %w", sha, err)
+				}
+				pr.messages[sha] = msg
+			}
+			src := sha
+			if o, ok := origin[sha]; ok {
+				src = o
+			}
+			if allSelected || selected[src] {
+				selectedCommits = append(selectedCommits, sha)
+				delete(selected, src)
+			}
+		}
+		if !allSelected {
+			for _, sha := range pr.selectedCommits {
+				if selected[sha] {
+					warnf("skipping %.10s (%s), which did not land with PR #%d",
+						sha, pr.subject(sha), pr.number)
+				}
+			}
+		}
+		if pr.squashed {
+			infof("Note: PR #%d was squash-merged; using %.10s rather than its %d commit(s).",
+				pr.number, pr.mergeCommit, len(pr.commits))
+		} else if differs {
+			infof("Note: using the %d commit(s) that landed in %.10s rather than the %d listed on PR #%d.",
+				len(landed), pr.mergeCommit, len(pr.commits), pr.number)
+		}
+		pr.commits, pr.selectedCommits = landed, selectedCommits
+	}
+	return nil
+}
+
+// landedCommits returns the commits that pr actually landed on its base
+// branch, oldest first, or nil if they cannot be determined. For commits that
+// are rewritten copies of the PR's commits, origin maps them to the commit on
+// the PR that they were copied from.
+//
+// If the merge commit that GitHub reports is not on master, as happens with
+// bors-style merge queues, the queue's "Merge #N" commit on master is used
+// instead. A merge commit lands the commits reachable from the parent that
+// carries the PR, but not from its first parent; for octopus merges of a
+// batch of PRs, that parent is the PR's head commit. A PR that was rebased
+// onto master lands the corresponding number of commits ending in the merge
+// commit, provided their subjects match; otherwise the PR was squash-merged
+// and landed only the merge commit itself, and pr.squashed is set.
+func (pr *pullRequest) landedCommits() (landed []string, origin map[string]string, err error) {
+	if pr.baseBranch == "master" {
+		if _, err := capture("git", "merge-base", "--is-ancestor", pr.mergeCommit, "FETCH_HEAD"); err != nil {
+			queued, err := capture("git", "log", "--first-parent", "-n1", "--format=%H", "-E",
+				"--grep", fmt.Sprintf(`^Merge( #[0-9]+)* #%d\b`, pr.number), "FETCH_HEAD")
+			if err != nil {
+				return nil, nil, fmt.Errorf("looking for the merge queue commit of PR #%d: %w", pr.number, err)
+			}
+			if queued == "" {
+				return nil, nil, nil
+			}
+			pr.mergeCommit = queued
+		}
+	}
+
+	out, err := capture("git", "rev-list", "--parents", "-n1", pr.mergeCommit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inspecting merge commit of PR #%d: %w", pr.number, err)
+	}
+	parents := strings.Fields(out)[1:]
+
+	out = ""
+	switch {
+	case len(parents) == 2:
+		out, err = capture("git", "rev-list", "--reverse", "--no-merges",
+			parents[0]+".."+pr.mergeCommit)
+	case len(parents) > 2:
+		// An octopus merge, e.g. by a merge queue that batched several PRs,
+		// has the head of each of them as a parent.
+		var found bool
+		if len(pr.commits) > 0 {
+			head := pr.commits[len(pr.commits)-1]
+			for _, parent := range parents[1:] {
+				if parent == head {
+					found = true
+					out, err = capture("git", "rev-list", "--reverse", "--no-merges", parents[0]+".."+head)
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("merge commit %s of PR #%d does not merge the head of the PR",
+				pr.mergeCommit, pr.number)
+		}
+	case len(parents) == 1 && len(pr.commits) > 0:
+		out, err = capture("git", "rev-list", "--reverse", "--first-parent",
+			fmt.Sprintf("-n%d", len(pr.commits)), pr.mergeCommit)
+		if err != nil {
+			break
+		}
+		rebased := strings.Fields(out)
+		squashed := len(rebased) != len(pr.commits)
+		origin = map[string]string{}
+		for i := 0; i < len(rebased) && !squashed; i++ {
+			subject, err := capture("git", "log", "-n1", "--format=%s", rebased[i])
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading subject of commit %s: %w", rebased[i], err)
+			}
+			squashed = subject != pr.subject(pr.commits[i])
+			origin[rebased[i]] = pr.commits[i]
+		}
+		if squashed {
+			pr.squashed = true
+			return []string{pr.mergeCommit}, nil, nil
+		}
+		return rebased, origin, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing commits landed by PR #%d: %w", pr.number, err)
+	}
+	return strings.Fields(out), nil, nil
+}
+
+// checkUnmerged refuses to backport PRs that have not been merged, as their
+// commits may still change before they land, leaving the backport to diverge
+// from what is eventually merged. The check is an error unless --force is
+// specified.
+func checkUnmerged(prs pullRequests) error {
+	var unmerged []int
+	for _, pr := range prs {
+		if pr.mergeCommit == "" && !pr.isRaw() {
+			unmerged = append(unmerged, pr.number)
+		}
+	}
+	if len(unmerged) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("PR %s has not been merged", formatPRNumbers(unmerged))
+	if len(unmerged) > 1 {
+		msg = fmt.Sprintf("PRs %s have not been merged", formatPRNumbers(unmerged))
+	}
+	if force {
+		warnf("%s", msg)
+		return nil
+	}
+	return hintedErr{
+		error: errors.New(msg),
+		hint: `wait until the PRs have merged, so that the backport matches what
+lands. To backport their current commits anyway, rerun with --force.`,
+	}
+}
+
+// checkReverted looks for commits on master, which must have just been fetched
+// into FETCH_HEAD, that revert any of the PRs, as backporting a change that was
+// reverted upstream is almost always a mistake. The check is an error unless
+// --force is specified.
+func checkReverted(prs pullRequests) error {
+	var reverts []string
+	for _, pr := range prs {
+		if pr.mergeCommit == "" {
+			continue
+		}
+		args := []string{"git", "log", "--format=%h %s", "-F"}
+		for _, sha := range append([]string{pr.mergeCommit}, pr.commits...) {
+			args = append(args, "--grep", "This reverts commit "+sha)
+		}
+		args = append(args, pr.mergeCommit+"..FETCH_HEAD")
+		out, err := capture(args...)
+		if err != nil {
+			return fmt.Errorf("checking whether PR #%d was reverted: %w", pr.number, err)
+		}
+		if out != "" {
+			reverts = append(reverts, fmt.Sprintf("PR #%d was reverted on master by:\n        %s",
+				pr.number, strings.Replace(out, "\n", "\n        ", -1)))
+		}
+	}
+	if len(reverts) == 0 {
+		return nil
+	}
+	msg := strings.Join(reverts, "\n    ")
+	if force {
+		warnf("%s", msg)
+		return nil
+	}
+	return hintedErr{
+		error: errors.New(msg),
+		hint: `backporting a change that was reverted on master is almost always a
+mistake. If you are sure, rerun with --force.`,
+	}
+}
+
+func (prs pullRequests) selectCommits(refs []string) error {
+	var includeRefs []string
+	var excludeRefs []string
+	for _, ref := range refs {
+		if strings.HasPrefix(ref, "!") {
+			excludeRefs = append(excludeRefs, ref[1:])
+		} else {
+			includeRefs = append(includeRefs, ref)
+		}
+	}
+
+	if len(includeRefs) > 0 {
+		for i := range prs {
+			prs[i].selectedCommits = nil
+		}
+	}
+
+	for _, ref := range includeRefs {
+		scoped, sha, err := prs.scope(ref)
+		if err != nil {
+			return err
+		}
+		pr, commit, err := scoped.findCommit(prs, ref, sha, func(pr pullRequest) []string {
+			return pr.commits
+		})
+		if err != nil {
+			return err
+		}
+		pr.selectedCommits = append(pr.selectedCommits, commit)
+	}
+
+	for _, ref := range excludeRefs {
+		scoped, sha, err := prs.scope(ref)
+		if err != nil {
+			return err
+		}
+		if pattern := strings.TrimPrefix(sha, "re:"); pattern != sha {
+			if err := scoped.excludeMatching(pattern); err != nil {
+				return err
+			}
+			continue
+		}
+		pr, excluded, err := scoped.findCommit(prs, "!"+ref, sha, func(pr pullRequest) []string {
+			return pr.selectedCommits
+		})
+		if err != nil {
+			return err
+		}
+		var kept []string
+		for _, commit := range pr.selectedCommits {
+			if commit != excluded {
+				kept = append(kept, commit)
+			}
+		}
+		pr.selectedCommits = kept
+	}
+
+	return nil
+}
+
+var scopedCommitRefRE = regexp.MustCompile(`^#?(\d+):(.+)$`)
+
+// scope returns the PRs that a commit ref applies to, along with the ref
+// stripped of its scope. A ref may be scoped to one of the PRs by prefixing it
+// with the PR number, as in 12345:00c6a87, which keeps short SHAs unambiguous
+// when several PRs are backported together. Unscoped refs apply to all PRs.
+func (prs pullRequests) scope(ref string) (pullRequests, string, error) {
+	m := scopedCommitRefRE.FindStringSubmatch(ref)
+	if m == nil {
+		return prs, ref, nil
+	}
+	prNo, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid PR number in commit ref %q: %w", ref, err)
+	}
+	for i := range prs {
+		if prs[i].number == prNo {
+			return prs[i : i+1], m[2], nil
+		}
+	}
+	return nil, "", fmt.Errorf("commit ref %q names PR #%d, which is not among the specified PRs", ref, prNo)
+}
+
+// description describes prs, as returned by all.scope, for use in error
+// messages.
+func (prs pullRequests) description(all pullRequests) string {
+	if len(prs) == 1 && len(all) > 1 {
+		return fmt.Sprintf("PR #%d", prs[0].number)
+	}
+	return "any of the specified PRs"
+}
+
+// findCommit returns the commit that sha, a prefix of a commit SHA given as
+// ref on the command line, refers to among the commits that commitsOf lists
+// for prs, as returned by all.scope, along with the PR it belongs to. If sha is
+// ambiguous, the user is asked to pick one of the matches.
+func (prs pullRequests) findCommit(
+	all pullRequests, ref, sha string, commitsOf func(pullRequest) []string,
+) (*pullRequest, string, error) {
+	var matches []commitMatch
+	for i := range prs {
+		for _, commit := range commitsOf(prs[i]) {
+			if strings.HasPrefix(commit, sha) {
+				matches = append(matches, commitMatch{pr: &prs[i], commit: commit})
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, "", fmt.Errorf("commit %q was not found in %s", sha, prs.description(all))
+	case 1:
+		return matches[0].pr, matches[0].commit, nil
+	}
+	m, err := pickCommitMatch(ref, matches)
+	if err != nil {
+		return nil, "", err
+	}
+	return m.pr, m.commit, nil
+}
+
+// commitMatch is one of the commits that a commit ref matches.
+type commitMatch struct {
+	pr     *pullRequest
+	commit string
+}
+
+// pickCommitMatch lets the user choose between the commits that the ambiguous
+// ref matches. If stdin is not a terminal, it instead returns an error listing
+// them.
+func pickCommitMatch(ref string, matches []commitMatch) (commitMatch, error) {
+	var list strings.Builder
+	samePR := true
+	for i, m := range matches {
+		fmt.Fprintf(&list, "\n    %d) %.10s  #%d  %s", i+1, m.commit, m.pr.number, m.pr.subject(m.commit))
+		samePR = samePR && m.pr == matches[0].pr
+	}
+	if !isInteractive() {
+		hint := "specify more of the commit SHA."
+		if !samePR {
+			example := fmt.Sprintf("%d:%s", matches[0].pr.number, ref)
+			if strings.HasPrefix(ref, "!") {
+				example = fmt.Sprintf("'!%d:%s'", matches[0].pr.number, ref[1:])
+			}
+			hint = fmt.Sprintf("specify more of the commit SHA, or scope it to one of the PRs, e.g.\n-c %s.", example)
+		}
+		return commitMatch{}, hintedErr{
+			error: fmt.Errorf("commit ref %q is ambiguous; it matches:%s", ref, list.String()),
+			hint:  hint,
+		}
+	}
+	renderer.Prompt(fmt.Sprintf("Commit ref %q is ambiguous; it matches:%s\n", ref, list.String()))
+	answer, err := prompt(fmt.Sprintf("Which commit did you mean? [1-%d] ", len(matches)))
+	if err != nil {
+		return commitMatch{}, err
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(matches) {
+		return commitMatch{}, fmt.Errorf("invalid choice %q for commit ref %q", answer, ref)
+	}
+	return matches[n-1], nil
+}
+
+// grepCommits deselects every selected commit whose message does not match at
+// least one of the specified regular expressions. If no patterns are
+// specified, the selection is left untouched.
+func (prs pullRequests) grepCommits(patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --grep pattern %q: %w", pattern, err)
+		}
+		res = append(res, re)
+	}
+	var found bool
+	for i := range prs {
+		var kept []string
+		for _, commit := range prs[i].selectedCommits {
+			for _, re := range res {
+				if re.MatchString(prs[i].messages[commit]) {
+					kept = append(kept, commit)
+					found = true
+					break
+				}
+			}
+		}
+		prs[i].selectedCommits = kept
+	}
+	if !found {
+		return errors.New("no selected commits match the --grep patterns")
+	}
+	return nil
+}
+
+// excludeMatching deselects every selected commit whose subject matches the
+// specified regular expression.
+func (prs pullRequests) excludeMatching(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid commit pattern %q: %w", pattern, err)
+	}
+	var found bool
+	for i := range prs {
+		var kept []string
+		for _, commit := range prs[i].selectedCommits {
+			if re.MatchString(prs[i].subject(commit)) {
+				found = true
+				continue
+			}
+			kept = append(kept, commit)
+		}
+		prs[i].selectedCommits = kept
+	}
+	if !found {
+		return fmt.Errorf("no commit subject in the specified PRs matches %q", pattern)
+	}
+	return nil
+}
+
+// subject returns the first line of the message of the specified commit.
+func (pr pullRequest) subject(sha string) string {
+	return strings.SplitN(pr.messages[sha], "\n", 2)[0]
+}
+
+func (prs pullRequests) selectedCommits() []string {
+	var commits []string
+	for _, pr := range prs {
+		commits = append(commits, pr.selectedCommits...)
+	}
+	return commits
+}
+
+func (prs pullRequests) selectedPRs() pullRequests {
+	var selectedPRs []pullRequest
+	for _, pr := range prs {
+		if len(pr.selectedCommits) > 0 {
+			selectedPRs = append(selectedPRs, pr)
+		}
+	}
+	return selectedPRs
+}
+
+func (prs pullRequests) title(destBranch *destinationBranch) string {
+	prs = prs.selectedPRs()
+	if len(prs) == 1 && prs[0].isRaw() {
+		if len(prs[0].selectedCommits) == 1 {
+			return fmt.Sprintf("%s: %s", destBranch.branch, prs[0].subject(prs[0].selectedCommits[0]))
+		}
+	} else if len(prs) == 1 {
+		// Backports of backports and forward ports would otherwise carry
+		// both branch prefixes.
+		return fmt.Sprintf("%s: %s", destBranch.branch, strings.TrimPrefix(prs[0].title, prs[0].baseBranch+": "))
+	}
+	return fmt.Sprintf("%s: TODO", destBranch.branch)
+}
+
+// promptTitle asks the user for the title of the backport of several PRs,
+// which cannot be generated, and returns it without the destination branch
+// prefix. An empty answer keeps the "TODO" title.
+func (prs pullRequests) promptTitle(destBranch *destinationBranch) (string, error) {
+	var list strings.Builder
+	for _, pr := range prs.selectedPRs() {
+		if pr.isRaw() {
+			for _, sha := range pr.selectedCommits {
+				fmt.Fprintf(&list, "    %.10s  %s\n", sha, pr.subject(sha))
+			}
+			renderer.Prompt(fmt.Sprintf("Backporting several commits:\n%s", list.String()))
+			return prompt(fmt.Sprintf("Title for the backport PR: %s: ", destBranch.branch))
+		}
+		fmt.Fprintf(&list, "    #%d  %s\n", pr.number, pr.title)
+	}
+	renderer.Prompt(fmt.Sprintf("Backporting several PRs:\n%s", list.String()))
+	return prompt(fmt.Sprintf("Title for the backport PR: %s: ", destBranch.branch))
+}
+
+// message returns the generated body of the backport of prs to destBranch,
+// which mentions cc, if set, e.g. the team returned by resolveReleaseTeam.
+func (prs pullRequests) message(destBranch *destinationBranch, cc string) string {
+	prs = prs.selectedPRs()
+	verb := "Backport"
+	if destBranch.isForwardPort() {
+		verb = "Forward-port"
+	}
+	var s strings.Builder
+	if len(prs) == 1 && prs[0].isRaw() {
+		fmt.Fprintf(&s, "%s:\n", verb)
+		for _, sha := range prs[0].selectedCommits {
+			fmt.Fprintf(&s, "  * %.10s %s\n", sha, prs[0].subject(sha))
+		}
+	} else if len(prs) == 1 {
+		fmt.Fprintf(&s, "%s %d/%d commits from #%d.\n",
+			verb, len(prs[0].selectedCommits), len(prs[0].commits), prs[0].number)
+	} else {
+		fmt.Fprintf(&s, "%s:\n", verb)
+		for _, pr := range prs {
+			fmt.Fprintf(&s, "  * %d/%d commits from %q (#%d)\n",
+				len(pr.selectedCommits), len(pr.commits), pr.title, pr.number)
+		}
+		fmt.Fprintln(&s)
+		fmt.Fprintln(&s, "Please see individual PRs for details.")
+	}
+	var summaries []string
+	for _, pr := range prs {
+		if summary := pr.mergeSummary(); summary != "" {
+			summaries = append(summaries, summary)
+		}
+	}
+	if len(summaries) > 0 {
+		fmt.Fprintln(&s)
+		fmt.Fprintln(&s, strings.Join(summaries, "\n"))
+	}
+	// Record the provenance of backports of backports, so that the chain
+	// back to the original PR can be followed.
+	for _, pr := range prs {
+		if sources := backportSources(pr.body); pr.baseBranch != "master" && len(sources) > 0 {
+			fmt.Fprintf(&s, "\n#%d is itself a backport of %s to %s.\n",
+				pr.number, formatPRNumbers(sources), pr.baseBranch)
+		}
+	}
+	if refs := prs.references(); len(refs) > 0 {
+		fmt.Fprintln(&s)
+		for _, ref := range refs {
+			fmt.Fprintln(&s, ref)
+		}
+	}
+	if cc != "" {
+		fmt.Fprintln(&s)
+		fmt.Fprintln(&s, "/cc "+cc)
+	}
+	if len(prs) == 1 {
+		fmt.Fprintln(&s)
+		fmt.Fprintln(&s, "---")
+		fmt.Fprintln(&s)
+		fmt.Fprintln(&s, neutralizeClosingKeywords(prs[0].body))
+	}
+	return s.String()
+}
+
+var closingKeywordRE = regexp.MustCompile(`(?i)\b(?:fix(?:es|ed)?|close[sd]?|resolve[sd]?)(:?\s+)((?:[\w.-]+/[\w.-]+)?#\d+|https?://\S+/issues/\d+)`)
+
+// neutralizeClosingKeywords rewrites references such as "Fixes #123" in body
+// to "Part of #123", so that merging the backport does not close the issues
+// that the original PR fixes; the fix on master is what closes them.
+func neutralizeClosingKeywords(body string) string {
+	return closingKeywordRE.ReplaceAllString(body, "Part of$1$2")
+}
+
+var referenceRE = regexp.MustCompile(`(?im)^[ \t]*(epic|informs):[ \t]*(\S.*?)[ \t]*$`)
+
+// references returns the "Epic:" and "Informs:" lines found in the bodies and
+// selected commit messages of prs, which are required on backport PRs too.
+// Lines that are already part of the backport's body, because it includes the
+// body of a single PR, are left out, as is "Epic: none" if an epic is named.
+func (prs pullRequests) references() []string {
+	var texts []string
+	for _, pr := range prs {
+		texts = append(texts, pr.body)
+		for _, sha := range pr.selectedCommits {
+			texts = append(texts, pr.messages[sha])
+		}
+	}
+	seen := map[string]bool{}
+	var epics, informs []string
+	for _, text := range texts {
+		for _, m := range referenceRE.FindAllStringSubmatch(text, -1) {
+			kind, ref := strings.Title(strings.ToLower(m[1])), m[2]
+			line := kind + ": " + ref
+			if seen[strings.ToLower(line)] {
+				continue
+			}
+			seen[strings.ToLower(line)] = true
+			if kind == "Epic" {
+				epics = append(epics, line)
+			} else {
+				informs = append(informs, line)
+			}
+		}
+	}
+	if len(epics) > 1 {
+		var named []string
+		for _, line := range epics {
+			if !strings.EqualFold(line, "Epic: none") {
+				named = append(named, line)
+			}
+		}
+		epics = named
+	}
+
+	var refs []string
+	for _, line := range append(epics, informs...) {
+		if len(prs) == 1 && referenceInBody(prs[0].body, line) {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs
+}
+
+// referenceInBody reports whether body contains the reference line.
+func referenceInBody(body, line string) bool {
+	for _, m := range referenceRE.FindAllStringSubmatch(body, -1) {
+		if strings.EqualFold(m[1]+": "+m[2], line) {
+			return true
+		}
+	}
+	return false
+}
+
+// backportLabel returns the name of the label that marks a PR as needing a
+// backport to the specified release.
+func backportLabel(release string) string {
+	return fmt.Sprintf("backport-%s.x", release)
+}
+
+var backportLabelRE = regexp.MustCompile(`^backport-(.+)\.x$`)
+
+// labeledReleases returns the releases that the PRs are labeled as needing a
+// backport to, in the order they are first encountered.
+func (prs pullRequests) labeledReleases() []string {
+	var releases []string
+	seen := map[string]bool{}
+	for _, pr := range prs {
+		for _, label := range pr.labels {
+			m := backportLabelRE.FindStringSubmatch(label)
+			if m == nil || seen[m[1]] {
+				continue
+			}
+			seen[m[1]] = true
+			releases = append(releases, m[1])
+		}
+	}
+	return releases
+}
+
+// confirmLabeledReleases returns the releases that the PRs are labeled for,
+// after asking the user to confirm them if stdin is a terminal. If the PRs
+// have no backport labels, it returns nil, selecting the latest release.
+func confirmLabeledReleases(prs pullRequests) ([]string, error) {
+	releases := prs.labeledReleases()
+	if len(releases) == 0 {
+		return nil, nil
+	}
+	if !isInteractive() {
+		infof("Backporting to %s, per the PR labels.", strings.Join(releases, ", "))
+		return releases, nil
+	}
+	answer, err := prompt(fmt.Sprintf("PR labels request backports to %s. Proceed? [Y/n] ",
+		strings.Join(releases, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.ToLower(answer), "n") {
+		return nil, errors.New("backport cancelled; use --release to choose the releases")
+	}
+	return releases, nil
+}
+
+var backportSourceRE = regexp.MustCompile(`(?m)commits from (?:#(\d+)\.|".*" \(#(\d+)\))$`)
+
+// backportSources extracts the numbers of the source PRs from the body of a
+// backport PR, as generated by pullRequests.message.
+func backportSources(body string) []int {
+	var prNos []int
+	for _, m := range backportSourceRE.FindAllStringSubmatch(body, -1) {
+		s := m[1]
+		if s == "" {
+			s = m[2]
+		}
+		prNo, err := strconv.Atoi(s)
+		if err != nil {
+			continue
+		}
+		prNos = append(prNos, prNo)
+	}
+	return prNos
+}
+
+type hintedErr struct {
+	hint string
+	error
+}
+
+// githubHost returns the GitHub host. For GitHub Enterprise Server, the host
+// is derived from the configured API URL.
+func githubHost() (string, error) {
+	githubAPI := gitConfig("backport.githubAPI")
+	if githubAPI == "" {
+		return "github.com", nil
+	}
+	u, err := url.Parse(githubAPI)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("backport.githubAPI must be a URL like https://github.example.com/api/v3/, not %q", githubAPI)
+	}
+	return u.Host, nil
+}
+
+// githubToken returns the token to authenticate to host with. The environment
+// takes precedence, so that CI jobs can pass a token, followed by the token
+// stored by 'backport auth login' in the OS keychain, so that users need not
+// store theirs in plain text in their Git config, and cockroach.githubToken.
+func githubToken(host string) string {
+	for _, name := range []string{"BACKPORT_GITHUB_TOKEN", "GITHUB_TOKEN"} {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	if token, err := keychainLookup(host); err == nil && token != "" {
+		return token
+	}
+	return gitConfig("cockroach.githubToken")
+}
+
+// errTokenRequired reports that an operation needs a GitHub token, which is
+// not configured.
+func errTokenRequired(operation string) error {
+	return hintedErr{
+		error: fmt.Errorf("%s requires a GitHub token", operation),
+		hint: `configure backport with a personal access token, either by storing it
+in the OS keychain or in the BACKPORT_GITHUB_TOKEN environment variable:
+
+    $ backport auth login
+
+Without one, backport can still plan backports, e.g. with --dry-run, and
+open PRs in your browser.`,
+	}
+}
+
+func whenForced(forced, unforced string) string {
+	if force {
+		return forced
+	}
+	return unforced
+}
+
+func browserCmd(url string) []string {
+	var cmd []string
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = append(cmd, "/usr/bin/open")
+	case "windows":
+		cmd = append(cmd, "cmd", "/c", "start")
+	default:
+		cmd = append(cmd, "xdg-open")
+	}
+	cmd = append(cmd, url)
+	return cmd
+}
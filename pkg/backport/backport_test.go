@@ -0,0 +1,162 @@
+package backport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePRArgs(t *testing.T) {
+	c := config{githubHost: "github.com", upstreamOwner: "cockroachdb", upstreamRepo: "cockroach"}
+	for _, tc := range []struct {
+		args    []string
+		want    []int
+		wantErr bool
+	}{
+		{args: []string{"23437"}, want: []int{23437}},
+		{args: []string{"#23437"}, want: []int{23437}},
+		{args: []string{"cockroachdb/cockroach#23437"}, want: []int{23437}},
+		{args: []string{"CockroachDB/Cockroach#23437"}, want: []int{23437}},
+		{args: []string{"https://github.com/cockroachdb/cockroach/pull/23437"}, want: []int{23437}},
+		{args: []string{"https://github.com/cockroachdb/cockroach/pull/23437/files"}, want: []int{23437}},
+		{args: []string{"https://github.com/cockroachdb/cockroach/pull/23437#issuecomment-1"}, want: []int{23437}},
+		{args: []string{"23389", "#23437", "23389"}, want: []int{23389, 23437}},
+		{args: []string{"0"}, wantErr: true},
+		{args: []string{"abc"}, wantErr: true},
+		{args: []string{"other/repo#23437"}, wantErr: true},
+		{args: []string{"https://github.com/other/repo/pull/23437"}, wantErr: true},
+		{args: []string{"https://example.com/cockroachdb/cockroach/pull/23437"}, wantErr: true},
+		{args: []string{"23437", "abc"}, wantErr: true},
+	} {
+		got, err := parsePRArgs(c, tc.args)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parsePRArgs(%q): got error %v, want error: %t", tc.args, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parsePRArgs(%q) = %v, want %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestParseCompareURL(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		c              config
+		destBranch     string
+		backportBranch string
+	}{
+		{
+			name:           "fork",
+			c:              config{username: "alice", forkRepo: "cockroach"},
+			destBranch:     "release-23.1",
+			backportBranch: "backport23.1-23437",
+		},
+		{
+			name:           "fork named differently",
+			c:              config{username: "alice", forkRepo: "crdb"},
+			destBranch:     "release-23.1",
+			backportBranch: "backport23.1-23389-23437",
+		},
+		{
+			name:           "shared fork",
+			c:              config{username: "release-team", forkRepo: "cockroach", sharedFork: true, login: "alice"},
+			destBranch:     "release-23.1.10-rc",
+			backportBranch: "alice/backport23.1.10-rc-23437",
+		},
+		{
+			name:           "raw commits",
+			c:              config{username: "alice", forkRepo: "cockroach"},
+			destBranch:     "release-23.2",
+			backportBranch: "backport23.2-g00c6a87a1b",
+		},
+		{
+			name:           "forward-port",
+			c:              config{username: "alice", forkRepo: "cockroach"},
+			destBranch:     "master",
+			backportBranch: "backportmaster-23437",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.c.githubHost, tc.c.upstreamOwner, tc.c.upstreamRepo = "github.com", "cockroachdb", "cockroach"
+			u := compareURL(tc.c, newDestinationBranch(tc.destBranch), tc.backportBranch,
+				"release-23.1: sql: fix foo", "Backport 1/1 commits from #23437.\n\nsee https://x/?a=b")
+			destBranch, backportBranch, err := parseCompareURL(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if destBranch != tc.destBranch || backportBranch != tc.backportBranch {
+				t.Errorf("parseCompareURL(%s) = %q, %q, want %q, %q",
+					u, destBranch, backportBranch, tc.destBranch, tc.backportBranch)
+			}
+		})
+	}
+	if _, _, err := parseCompareURL("https://github.com/cockroachdb/cockroach/pull/1"); err == nil {
+		t.Error("parseCompareURL accepted a URL that is not a compare URL")
+	}
+}
+
+func TestNeutralizeClosingKeywords(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Fixes #123.", "Part of #123."},
+		{"fixes: #123", "Part of: #123"},
+		{"Closes cockroachdb/cockroach#123", "Part of cockroachdb/cockroach#123"},
+		{"Resolved https://github.com/cockroachdb/cockroach/issues/123", "Part of https://github.com/cockroachdb/cockroach/issues/123"},
+		{"Fix #1 and close #2", "Part of #1 and Part of #2"},
+		{"Informs #123.", "Informs #123."},
+		{"This fixes a bug.", "This fixes a bug."},
+		{"prefixes #123", "prefixes #123"},
+	} {
+		if got := neutralizeClosingKeywords(tc.in); got != tc.want {
+			t.Errorf("neutralizeClosingKeywords(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBranchVersionLess(t *testing.T) {
+	// Each branch sorts before all of the branches after it.
+	ordered := []string{
+		"staging",
+		"release-2.1",
+		"release-19.2",
+		"release-23.1",
+		"release-23.1.9",
+		"release-23.1.10",
+		"release-23.1.10-rc",
+		"release-23.2",
+		"release-24.1",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			if got, want := branchVersionLess(a, b), i < j; got != want {
+				t.Errorf("branchVersionLess(%q, %q) = %t, want %t", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestBackportSources(t *testing.T) {
+	single := pullRequests{{number: 23437, title: "sql: fix foo", commits: []string{"a", "b"}, selectedCommits: []string{"a"}}}
+	multi := pullRequests{
+		{number: 23389, title: `sql: fix "foo"`, commits: []string{"a"}, selectedCommits: []string{"a"}},
+		{number: 23437, title: "kv: fix bar", commits: []string{"b"}, selectedCommits: []string{"b"}},
+	}
+	destBranch := newDestinationBranch("release-23.1")
+	for _, tc := range []struct {
+		name string
+		body string
+		want []int
+	}{
+		{name: "single", body: single.message(destBranch, ""), want: []int{23437}},
+		{name: "multi", body: multi.message(destBranch, "@cockroachdb/release"), want: []int{23389, 23437}},
+		{name: "template without sources", body: withSourceMarkers("## Summary\n\nBackports a fix.\n", multi), want: []int{23389, 23437}},
+		{name: "template with some sources", body: withSourceMarkers("Backport 1/1 commits from #23389.\n", multi), want: []int{23389, 23437}},
+		{name: "annotated", body: "Manual backport.\n\nRecorded by `backport annotate`: backports commits from #23437.", want: []int{23437}},
+		{name: "mid-line", body: "see the commits from #23437. for details", want: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := backportSources(tc.body); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("backportSources(%q) = %v, want %v", tc.body, got, tc.want)
+			}
+		})
+	}
+}
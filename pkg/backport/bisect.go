@@ -0,0 +1,155 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BisectOptions controls BisectMissing.
+type BisectOptions struct {
+	Release string   // the release whose branch has the bug
+	Branch  string   // the branch with the bug, instead of Release
+	Paths   []string // the paths that the fix is expected to touch
+}
+
+// BisectMissing lists the commits on master that touch opts.Paths but are
+// missing from the release branch, most likely fixes first. It helps find the
+// change to backport when a bug reproduces on a release branch but not on
+// master.
+func BisectMissing(ctx context.Context, opts BisectOptions) error {
+	return runBisectMissing(ctx, opts)
+}
+
+var (
+	bugFixNoteRE   = regexp.MustCompile(`(?im)^release note \(bug fix\)`)
+	fixesIssueRE   = regexp.MustCompile(`(?i)\b(?:fix(?:es|ed)?|close[sd]?|resolve[sd]?):?\s+((?:[\w.-]+/[\w.-]+)?#\d+)`)
+	informsIssueRE = regexp.MustCompile(`(?i)\b(?:informs|touches|see also):?\s+((?:[\w.-]+/[\w.-]+)?#\d+)`)
+	bugKeywordRE   = regexp.MustCompile(`(?i)\b(fix\w*|bug\w*|crash\w*|panic\w*|regress\w*|race|deadlock\w*|leak\w*|incorrect\w*|wrong|broken|corrupt\w*)\b`)
+	cherryPickedRE = regexp.MustCompile(`\(cherry picked from commit ([0-9a-f]{40})\)`)
+)
+
+// candidate is a master commit that may be the fix missing from a release
+// branch.
+type candidate struct {
+	sha     string
+	subject string
+	score   int
+	reasons []string
+}
+
+// scoreCandidate rates how likely the commit with the given message is to be
+// a bug fix: a "Release note (bug fix)" counts most, then a reference to an
+// issue that it fixes, then bug-related words in the subject and references
+// to other issues.
+func scoreCandidate(sha, message string) candidate {
+	cand := candidate{sha: sha, subject: strings.SplitN(message, "\n", 2)[0]}
+	if bugFixNoteRE.MatchString(message) {
+		cand.score += 4
+		cand.reasons = append(cand.reasons, "bug fix release note")
+	}
+	if m := fixesIssueRE.FindStringSubmatch(message); m != nil {
+		cand.score += 3
+		cand.reasons = append(cand.reasons, "fixes "+m[1])
+	}
+	if m := bugKeywordRE.FindStringSubmatch(cand.subject); m != nil {
+		cand.score += 2
+		cand.reasons = append(cand.reasons, fmt.Sprintf("%q in subject", strings.ToLower(m[1])))
+	}
+	if m := informsIssueRE.FindStringSubmatch(message); m != nil {
+		cand.score++
+		cand.reasons = append(cand.reasons, "informs "+m[1])
+	}
+	return cand
+}
+
+func runBisectMissing(ctx context.Context, opts BisectOptions) error {
+	if len(opts.Paths) == 0 {
+		return UsageError{errors.New("bisect-missing requires at least one path")}
+	}
+	if opts.Release != "" && opts.Branch != "" {
+		return UsageError{errors.New("cannot specify both --release and --branch")}
+	}
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	var releases []string
+	if opts.Release != "" {
+		releases = []string{opts.Release}
+	}
+	destBranches, err := getDestinationBranches(ctx, c, releases, opts.Branch)
+	if err != nil {
+		return err
+	}
+	destBranch := destBranches[0].branch
+
+	fetched := map[string]string{}
+	for _, branch := range []string{"master", destBranch} {
+		if err := fetchBranches(c, branch); err != nil {
+			return fmt.Errorf("fetching %q branch: %w", branch, err)
+		}
+		sha, err := capture("git", "rev-parse", "FETCH_HEAD")
+		if err != nil {
+			return fmt.Errorf("resolving %q branch: %w", branch, err)
+		}
+		fetched[branch] = sha
+	}
+	master, dest := fetched["master"], fetched[destBranch]
+
+	// Commits that were cherry-picked with -x but needed conflict resolution
+	// are not patch-identical to the original, so --cherry-pick misses them.
+	out, err := capture(append([]string{"git", "log", "--format=%B", master + ".." + dest, "--"},
+		opts.Paths...)...)
+	if err != nil {
+		return fmt.Errorf("listing commits on %s: %w", destBranch, err)
+	}
+	backported := map[string]bool{}
+	for _, m := range cherryPickedRE.FindAllStringSubmatch(out, -1) {
+		backported[m[1]] = true
+	}
+
+	out, err = capture(append([]string{"git", "log", "--no-merges", "--cherry-pick", "--right-only",
+		"--format=%H%x00%B%x1e", dest + "..." + master, "--"}, opts.Paths...)...)
+	if err != nil {
+		return fmt.Errorf("listing commits missing from %s: %w", destBranch, err)
+	}
+	var candidates []candidate
+	for _, entry := range strings.Split(out, "\x1e") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.SplitN(entry, "\x00", 2)
+		if len(fields) != 2 || backported[fields[0]] {
+			continue
+		}
+		candidates = append(candidates, scoreCandidate(fields[0], fields[1]))
+	}
+	if len(candidates) == 0 {
+		infof("No commits on master touching %s are missing from %s.",
+			strings.Join(opts.Paths, ", "), destBranch)
+		return nil
+	}
+	// git log lists the newest commits first, which breaks ties.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	infof("Commits on master touching %s that are missing from %s,\nmost likely fixes first:",
+		strings.Join(opts.Paths, ", "), destBranch)
+	for _, cand := range candidates {
+		pr := ""
+		if number, _ := commitPR(ctx, c, cand.sha); number != 0 {
+			pr = fmt.Sprintf("  #%d", number)
+		}
+		infof("    %.10s%s  %s", cand.sha, pr, cand.subject)
+		if len(cand.reasons) > 0 {
+			infof("                (%s)", strings.Join(cand.reasons, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package backport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScoreCandidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		message string
+		score   int
+		reasons []string
+	}{
+		{
+			name:    "unrelated",
+			message: "docs: update README\n\nRelease note: None",
+		},
+		{
+			name:    "bug fix release note",
+			message: "sql: add foo\n\nRelease note (bug fix): foo no longer bars.",
+			score:   4,
+			reasons: []string{"bug fix release note"},
+		},
+		{
+			name:    "fixes issue",
+			message: "sql: handle foo\n\nFixes: #123",
+			score:   3,
+			reasons: []string{"fixes #123"},
+		},
+		{
+			name:    "subject keyword",
+			message: "kv: avoid deadlock in foo",
+			score:   2,
+			reasons: []string{`"deadlock" in subject`},
+		},
+		{
+			name:    "body keyword only",
+			message: "kv: rework foo\n\nThis avoids a crash.",
+		},
+		{
+			name:    "informs issue",
+			message: "sql: refactor foo\n\nInforms cockroachdb/cockroach#456",
+			score:   1,
+			reasons: []string{"informs cockroachdb/cockroach#456"},
+		},
+		{
+			name:    "everything",
+			message: "sql: fix panic in foo\n\nFixes #123.\nInforms #456.\n\nRelease note (bug fix): foo no longer panics.",
+			score:   10,
+			reasons: []string{"bug fix release note", "fixes #123", `"fix" in subject`, "informs #456"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cand := scoreCandidate("abc", tc.message)
+			if cand.score != tc.score || !reflect.DeepEqual(cand.reasons, tc.reasons) {
+				t.Errorf("got score %d %q, want %d %q", cand.score, cand.reasons, tc.score, tc.reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package backport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// bundleReportRef prefixes the ref, named after the backport branch, of the
+// commit that holds the conflict report in a conflict bundle.
+const bundleReportRef = "refs/backport/report/"
+
+// conflictReport describes a backport that stopped on a conflict, so that
+// someone else can take it over. It is stored as report.json in a conflict
+// bundle.
+type conflictReport struct {
+	// Backport is the backport that conflicted, with Commits reduced to the
+	// commits that have yet to be cherry-picked, starting with the
+	// conflicting one.
+	Backport pendingBackport `json:"backport"`
+	// Base is the commit of the destination branch that the backport branch
+	// was created from.
+	Base string `json:"base"`
+	// Conflicts lists the paths that conflicted.
+	Conflicts []string `json:"conflicts"`
+	// ExportedBy is the GitHub user who ran into the conflict.
+	ExportedBy string `json:"exported_by"`
+}
+
+// writeConflictBundle writes the backport branch of p, which was created from
+// base and stopped on a conflict while cherry-picking commits, to a Git bundle
+// at p.Bundle, along with a conflictReport.
+func writeConflictBundle(c config, p pendingBackport, base string, commits []string) error {
+	out, err := capture("git", "rev-list", "--count", base+"..HEAD")
+	if err != nil {
+		return fmt.Errorf("counting cherry-picked commits: %w", err)
+	}
+	done, err := strconv.Atoi(out)
+	if err != nil || done > len(commits) {
+		return fmt.Errorf("unexpected number of cherry-picked commits %q", out)
+	}
+	out, err = capture("git", "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return fmt.Errorf("listing conflicts: %w", err)
+	}
+
+	report := conflictReport{Backport: p, Base: base, Conflicts: strings.Fields(out), ExportedBy: c.login}
+	report.Backport.Commits = commits[done:]
+	// The rest of the state is specific to this machine or invocation.
+	report.Backport.StackOn, report.Backport.StackBase = "", ""
+	report.Backport.Worktree, report.Backport.Origin = "", ""
+	report.Backport.Remote, report.Backport.Bundle = "", ""
+	js, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding conflict report: %w", err)
+	}
+
+	// Store the report in a commit, so that it can travel in the bundle.
+	blob, err := captureWithInput(string(js)+"\n", "git", "hash-object", "-w", "--stdin")
+	if err != nil {
+		return fmt.Errorf("storing conflict report: %w", err)
+	}
+	tree, err := captureWithInput(fmt.Sprintf("100644 blob %s\treport.json\n", blob), "git", "mktree")
+	if err != nil {
+		return fmt.Errorf("storing conflict report: %w", err)
+	}
+	commit, err := capture("git", "commit-tree", tree, "-m", "Conflict report for "+p.BackportBranch)
+	if err != nil {
+		return fmt.Errorf("storing conflict report: %w", err)
+	}
+	reportRef := bundleReportRef + p.BackportBranch
+	if err := spawn("git", "update-ref", reportRef, commit); err != nil {
+		return fmt.Errorf("storing conflict report: %w", err)
+	}
+	defer func() { _ = spawn("git", "update-ref", "-d", reportRef) }()
+
+	args := []string{"git", "bundle", "create", p.Bundle, reportRef}
+	if done > 0 {
+		args = append(args, "refs/heads/"+p.BackportBranch, "^"+base)
+	}
+	if err := spawn(args...); err != nil {
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	return nil
+}
+
+// runAdoptBundle takes over the backport in the conflict bundle at path: it
+// recreates the backport branch and state, and cherry-picks the remaining
+// commits, stopping on the conflict for the user to resolve.
+func runAdoptBundle(ctx context.Context, path string) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if ok {
+		return errors.New("backport already in progress")
+	}
+
+	heads, err := capture("git", "bundle", "list-heads", path)
+	if err != nil {
+		return fmt.Errorf("reading bundle %s: %w", path, err)
+	}
+	var backportBranch string
+	var hasBranch bool
+	for _, line := range strings.Split(heads, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.HasPrefix(fields[1], bundleReportRef) {
+			backportBranch = strings.TrimPrefix(fields[1], bundleReportRef)
+		} else if strings.HasPrefix(fields[1], "refs/heads/") {
+			hasBranch = true
+		}
+	}
+	if backportBranch == "" {
+		return fmt.Errorf("%s is not a backport conflict bundle", path)
+	}
+	destBranch, _, err := parseBackportBranch(backportBranch)
+	if err != nil {
+		return err
+	}
+	if _, err := capture("git", "rev-parse", "--verify", "refs/heads/"+backportBranch); err == nil && !force {
+		return hintedErr{
+			error: fmt.Errorf("branch %q already exists", backportBranch),
+			hint:  "delete it, or rerun with --force to overwrite it.",
+		}
+	}
+
+	// The bundle builds on the destination branch, and the remaining commits
+	// are usually on master.
+	err = fetchBranches(c, "master", destBranch.branch)
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", destBranch.branch, err)
+	}
+	if err := spawn("git", "fetch", path, bundleReportRef+backportBranch); err != nil {
+		return fmt.Errorf("fetching from bundle %s: %w", path, err)
+	}
+	js, err := capture("git", "show", "FETCH_HEAD:report.json")
+	if err != nil {
+		return fmt.Errorf("reading conflict report: %w", err)
+	}
+	var report conflictReport
+	if err := json.Unmarshal([]byte(js), &report); err != nil {
+		return fmt.Errorf("malformatted conflict report: %w", err)
+	}
+	p := report.Backport
+	if len(p.Commits) == 0 {
+		return errors.New("conflict report lists no commits to cherry-pick")
+	}
+
+	if hasBranch {
+		ref := "refs/heads/" + backportBranch
+		err = spawn("git", "fetch", path, "+"+ref+":"+ref)
+	} else {
+		err = spawn("git", "branch", "--force", backportBranch, report.Base)
+	}
+	if err != nil {
+		return fmt.Errorf("creating backport branch %q: %w", backportBranch, err)
+	}
+	err = spawn("git", "checkout", whenForced("--force", "--no-force"), backportBranch)
+	if err != nil {
+		return fmt.Errorf("checking out %q: %w", backportBranch, err)
+	}
+
+	if err := ioutil.WriteFile(c.urlFile(), []byte(p.URL), 0644); err != nil {
+		return fmt.Errorf("writing url file: %w", err)
+	}
+	if err := saveQueue(c, []pendingBackport{p}); err != nil {
+		return err
+	}
+	// The conflict happened, whoever resolves it.
+	if err := recordConflict(c); err != nil {
+		return err
+	}
+
+	infof("Adopted %s from %s, exported by @%s, which conflicted in:\n    %s",
+		backportBranch, path, report.ExportedBy, strings.Join(report.Conflicts, "\n    "))
+	args := []string{"git", "cherry-pick"}
+	if p.IgnoreSpace {
+		args = append(args, "-Xignore-all-space")
+	}
+	if p.RecordOrigin {
+		args = append(args, "-x")
+	}
+	if err := spawn(append(args, p.Commits...)...); err != nil {
+		return hintedErr{
+			error: err,
+			hint: `resolve the conflict, then run 'backport --continue' to finish the
+backport. To give up instead, run 'backport --abort'.`,
+		}
+	}
+	infof("The remaining commits cherry-picked cleanly. Run 'backport --continue' to finish the backport.")
+	return nil
+}
@@ -0,0 +1,150 @@
+package backport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// defaultCacheTTL is how long cached GitHub API responses are used without
+// revalidation, unless overridden by backport.cacheTTL.
+const defaultCacheTTL = 10 * time.Minute
+
+// cachingTransport caches the responses to GET requests on disk. Within ttl, a
+// cached response to a request for a path that matches fresh is used as is;
+// other cached responses are revalidated with their ETags, which GitHub does
+// not count against the rate limit if nothing changed. It keeps
+// unauthenticated use of the API, with its strict rate limit, viable, without
+// missing recent changes to PRs, e.g. that one merged.
+type cachingTransport struct {
+	base     http.RoundTripper
+	dir      string
+	identity string // the credentials that the responses were fetched with
+	ttl      time.Duration
+	paths    *regexp.Regexp // if set, only requests for matching paths are cached
+	fresh    *regexp.Regexp // requests for matching paths are served from the cache within ttl
+}
+
+// branchListPathRE matches the path of the GitHub API request that lists the
+// branches of a repository. Branches are created rarely enough to be listed
+// from the cache without revalidation.
+var branchListPathRE = regexp.MustCompile(`^/(?:api/v3/)?repos/[^/]+/[^/]+/branches$`)
+
+type cachedResponse struct {
+	Time   time.Time   `json:"time"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// newCachingTransport returns a cachingTransport that stores the responses to
+// requests made with the credentials identity, e.g. a token, in the user's
+// cache directory, or base itself if there is none. If paths is not nil, only
+// the responses to requests for matching paths are cached. Within ttl, the
+// responses to requests for paths that match fresh are used without
+// revalidation.
+func newCachingTransport(
+	base http.RoundTripper, identity string, ttl time.Duration, paths, fresh *regexp.Regexp,
+) http.RoundTripper {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return base
+	}
+	return &cachingTransport{
+		base:     base,
+		dir:      filepath.Join(dir, "backport", "api"),
+		identity: identity,
+		ttl:      ttl,
+		paths:    paths,
+		fresh:    fresh,
+	}
+}
+
+// path returns where the response to req is cached. Responses are keyed by the
+// credentials too, as they may see different things, e.g. private repositories.
+// Only a hash of them is stored.
+func (t *cachingTransport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(t.identity + " " + req.Header.Get("Accept") + " " + req.URL.String()))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:]))
+}
+
+// isFresh returns whether cached, the cached response to req, may be used
+// without revalidation.
+func (t *cachingTransport) isFresh(req *http.Request, cached *cachedResponse) bool {
+	return t.fresh != nil && t.fresh.MatchString(req.URL.Path) && time.Since(cached.Time) < t.ttl
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || (t.paths != nil && !t.paths.MatchString(req.URL.Path)) {
+		return t.base.RoundTrip(req)
+	}
+	path := t.path(req)
+	var cached *cachedResponse
+	if in, err := ioutil.ReadFile(path); err == nil {
+		cached = &cachedResponse{}
+		if err := json.Unmarshal(in, cached); err != nil {
+			cached = nil
+		}
+	}
+	if cached != nil && t.isFresh(req, cached) {
+		return cached.response(req), nil
+	}
+
+	if cached != nil && cached.Header.Get("ETag") != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.Header.Get("ETag"))
+	}
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotModified && cached != nil:
+		res.Body.Close()
+		cached.Time = time.Now()
+		t.store(path, cached)
+		return cached.response(req), nil
+	case res.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		t.store(path, &cachedResponse{Time: time.Now(), Header: res.Header, Body: body})
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return res, nil
+}
+
+// store saves r at path. The cache is best-effort, so errors are ignored.
+func (t *cachingTransport) store(path string, r *cachedResponse) {
+	out, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return
+	}
+	_ = ioutil.WriteFile(path, out, 0600)
+}
+
+func (r *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,56 @@
+package backport
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCachingTransportIsFresh(t *testing.T) {
+	t1 := &cachingTransport{ttl: 10 * time.Minute, fresh: branchListPathRE}
+	t2 := &cachingTransport{ttl: 10 * time.Minute}
+	for _, tc := range []struct {
+		name string
+		t    *cachingTransport
+		path string
+		age  time.Duration
+		want bool
+	}{
+		{"branches", t1, "/repos/cockroachdb/cockroach/branches", time.Minute, true},
+		{"branches on GHES", t1, "/api/v3/repos/cockroachdb/cockroach/branches", time.Minute, true},
+		{"stale branches", t1, "/repos/cockroachdb/cockroach/branches", 11 * time.Minute, false},
+		{"branch", t1, "/repos/cockroachdb/cockroach/branches/master", time.Minute, false},
+		{"pull request", t1, "/repos/cockroachdb/cockroach/pulls/1", time.Minute, false},
+		{"nothing fresh", t2, "/repos/cockroachdb/cockroach/branches", time.Minute, false},
+	} {
+		req, err := http.NewRequest(http.MethodGet, "https://api.github.com"+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached := &cachedResponse{Time: time.Now().Add(-tc.age)}
+		if got := tc.t.isFresh(req, cached); got != tc.want {
+			t.Errorf("%s: isFresh = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCachingTransportPath(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos/cockroachdb/cockroach/pulls/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anon := &cachingTransport{dir: "/cache"}
+	alice := &cachingTransport{dir: "/cache", identity: "token-a"}
+	bob := &cachingTransport{dir: "/cache", identity: "token-b"}
+	if anon.path(req) == alice.path(req) || alice.path(req) == bob.path(req) {
+		t.Error("responses for different credentials share a cache entry")
+	}
+	if alice.path(req) != alice.path(req.Clone(req.Context())) {
+		t.Error("identical requests do not share a cache entry")
+	}
+	other := req.Clone(req.Context())
+	other.Header.Set("Accept", "application/vnd.github.v3.diff")
+	if alice.path(req) == alice.path(other) {
+		t.Error("responses for different media types share a cache entry")
+	}
+}
@@ -0,0 +1,68 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// cascadeBranches returns the release branches from the newest down to the
+// oldest of the releases named by releaseArgs, in that order.
+func cascadeBranches(ctx context.Context, c config, releaseArgs []string) ([]*destinationBranch, error) {
+	if len(releaseArgs) == 0 {
+		return nil, errors.New("--cascade requires --release")
+	}
+	releaseBranches, err := listReleaseBranches(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	// Point release branches are not part of the cascade.
+	releaseBranches = seriesBranches(releaseBranches)
+	oldest := len(releaseBranches)
+	for _, releaseArg := range releaseArgs {
+		releaseBranch, err := resolveRelease(ctx, c, releaseArg)
+		if err != nil {
+			return nil, err
+		}
+		i := indexOf(releaseBranches, releaseBranch)
+		if i < 0 {
+			return nil, fmt.Errorf("%s is not a release branch", releaseBranch)
+		}
+		if i < oldest {
+			oldest = i
+		}
+	}
+	var destBranches []*destinationBranch
+	for i := len(releaseBranches) - 1; i >= oldest; i-- {
+		destBranches = append(destBranches, newDestinationBranch(releaseBranches[i]))
+	}
+	return destBranches, nil
+}
+
+func indexOf(s []string, v string) int {
+	for i := range s {
+		if s[i] == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// stackedCommits returns the commits to cherry-pick for a backport that is
+// stacked on the backport p.StackOn to p.StackBase: the commits of that
+// backport, including any conflict resolution it required.
+func stackedCommits(c config, p pendingBackport) ([]string, error) {
+	err := fetchBranches(c, p.StackBase)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %q branch: %w", p.StackBase, err)
+	}
+	out, err := capture("git", "rev-list", "--reverse", "--no-merges", "FETCH_HEAD.."+p.StackOn)
+	if err != nil {
+		return nil, fmt.Errorf("listing commits of %q: %w", p.StackOn, err)
+	}
+	if out == "" {
+		return nil, fmt.Errorf("backport branch %q has no commits to stack on", p.StackOn)
+	}
+	return strings.Split(out, "\n"), nil
+}
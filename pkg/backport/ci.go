@@ -0,0 +1,39 @@
+package backport
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ciMode is set while running with Options.CI, e.g. in GitHub Actions.
+var ciMode bool
+
+// ciCreated records the PRs and branches created in CI mode, for
+// writeCIOutputs.
+var ciCreated struct {
+	urls, branches []string
+}
+
+// writeCIOutputs reports the created PRs and backport branches as the pr-url
+// and branch step outputs, space-separated if there are several. They are
+// appended to the file named by $GITHUB_OUTPUT, or printed to stdout when
+// that is not set.
+func writeCIOutputs() error {
+	out := fmt.Sprintf("pr-url=%s\nbranch=%s\n",
+		strings.Join(ciCreated.urls, " "), strings.Join(ciCreated.branches, " "))
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		renderer.Info(strings.TrimSuffix(out, "\n"))
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening step output file: %w", err)
+	}
+	if _, err := f.WriteString(out); err != nil {
+		f.Close()
+		return fmt.Errorf("writing step outputs: %w", err)
+	}
+	return f.Close()
+}
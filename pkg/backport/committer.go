@@ -0,0 +1,77 @@
+package backport
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+)
+
+// resolveCommitter returns the identity that backported commits are committed
+// as: the one given with --committer, or else backport.committer, or nothing
+// to leave it to Git. The identity must be of the form "NAME <EMAIL>", and if
+// the repository restricts committer emails with the multi-valued
+// backport.allowedCommitterEmail option, typically in .backportrc, its email
+// must match one of those glob patterns, e.g. *@cockroachlabs.com.
+func resolveCommitter(flag string) (string, error) {
+	committer, source := flag, "--committer"
+	if committer == "" {
+		committer, source = gitConfig("backport.committer"), "backport.committer"
+	}
+	if committer == "" {
+		return "", nil
+	}
+	if err := checkCommitter(committer, source, gitConfigAll("backport.allowedCommitterEmail")); err != nil {
+		return "", err
+	}
+	return committer, nil
+}
+
+// checkCommitter checks that committer, given by source, is of the form
+// "NAME <EMAIL>", and that its email matches one of the glob patterns in
+// allowed, unless there are none.
+func checkCommitter(committer, source string, allowed []string) error {
+	addr, err := mail.ParseAddress(committer)
+	if err != nil || addr.Name == "" {
+		return fmt.Errorf("%s must be of the form \"NAME <EMAIL>\", not %q", source, committer)
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range allowed {
+		match, err := path.Match(strings.ToLower(pattern), strings.ToLower(addr.Address))
+		if err != nil {
+			return fmt.Errorf("invalid backport.allowedCommitterEmail pattern %q: %w", pattern, err)
+		}
+		if match {
+			return nil
+		}
+	}
+	return hintedErr{
+		error: fmt.Errorf("committer email %s is not allowed in this repository", addr.Address),
+		hint: fmt.Sprintf(`backport.allowedCommitterEmail requires it to match one of:
+
+    %s`, strings.Join(allowed, "\n    ")),
+	}
+}
+
+// useCommitter makes p's committer, if it has one, the committer of the
+// commits that Git makes from now on, e.g. when cherry-picking, squashing, or
+// adding trailers, until the state saved by saveState is restored. The
+// authors of the commits are unaffected.
+func useCommitter(p pendingBackport) error {
+	if p.Committer == "" {
+		return nil
+	}
+	addr, err := mail.ParseAddress(p.Committer)
+	if err != nil {
+		return fmt.Errorf("malformed committer %q: %w", p.Committer, err)
+	}
+	for i, v := range []string{addr.Name, addr.Address} {
+		if err := os.Setenv(committerEnv[i], v); err != nil {
+			return fmt.Errorf("setting committer: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package backport
+
+import "testing"
+
+func TestCheckCommitter(t *testing.T) {
+	for _, tc := range []struct {
+		committer string
+		allowed   []string
+		wantErr   bool
+	}{
+		{committer: "Release Bot <bot@cockroachlabs.com>"},
+		{committer: `"Bot, Release" <bot@cockroachlabs.com>`},
+		{committer: "bot@cockroachlabs.com", wantErr: true},
+		{committer: "Release Bot", wantErr: true},
+		{committer: "Release Bot <bot>", wantErr: true},
+		{committer: "Release Bot <bot@cockroachlabs.com>", allowed: []string{"*@cockroachlabs.com"}},
+		{committer: "Release Bot <Bot@CockroachLabs.com>", allowed: []string{"*@cockroachlabs.com"}},
+		{committer: "Release Bot <bot@example.com>", allowed: []string{"*@cockroachlabs.com", "bot@example.com"}},
+		{committer: "Release Bot <bot@example.com>", allowed: []string{"*@cockroachlabs.com"}, wantErr: true},
+		{committer: "Release Bot <bot@cockroachlabs.com.evil>", allowed: []string{"*@cockroachlabs.com"}, wantErr: true},
+		{committer: "Release Bot <bot@cockroachlabs.com>", allowed: []string{"[@cockroachlabs.com"}, wantErr: true},
+	} {
+		err := checkCommitter(tc.committer, "--committer", tc.allowed)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("checkCommitter(%q, %q): got error %v, want error: %t", tc.committer, tc.allowed, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// selectorRE matches references to exported identifiers of other
+	// packages, e.g. clusterversion.V23_2 or sql.NewFoo.
+	selectorRE = regexp.MustCompile(`\b([a-z][a-z0-9_]*)\.([A-Z][A-Za-z0-9_]*)\b`)
+	// declRE matches declarations of identifiers.
+	declRE = regexp.MustCompile(`^\s*(?:func\s+(?:\([^)]*\)\s*)?|type\s+|var\s+|const\s+)?([A-Z][A-Za-z0-9_]*)\b`)
+	// clusterSettingRE matches cluster settings referenced from SQL.
+	clusterSettingRE = regexp.MustCompile(`(?i)\bCLUSTER SETTING\s+([a-z0-9_]+(?:\.[a-z0-9_]+)+)`)
+)
+
+// compatWarnings looks for signs that the commits rely on things that are
+// absent from each of destBranches: version gates, cluster settings, and
+// other exported identifiers that were introduced on master after the release
+// branch was cut. The checks are heuristics based on the lines the commits
+// add; the result maps each destination branch to its warnings.
+func compatWarnings(
+	ctx context.Context, c config, destBranches []*destinationBranch, commits []string,
+) (map[string][]string, error) {
+	symbols, settings, err := referencedNames(commits)
+	if err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 && len(settings) == 0 {
+		return nil, nil
+	}
+
+	warnings := map[string][]string{}
+	for _, destBranch := range destBranches {
+		err := fetchBranches(c, destBranch.branch)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %q branch: %w", destBranch.branch, err)
+		}
+		var names []string
+		for name := range symbols {
+			names = append(names, name)
+		}
+		for name := range settings {
+			names = append(names, name)
+		}
+		present, err := grepTree("FETCH_HEAD", names)
+		if err != nil {
+			return nil, err
+		}
+
+		var ws []string
+		for name, pkg := range symbols {
+			if present[name] {
+				continue
+			}
+			if pkg == "clusterversion" {
+				ws = append(ws, fmt.Sprintf("version gate clusterversion.%s does not exist", name))
+			} else {
+				ws = append(ws, fmt.Sprintf("%s.%s does not exist", pkg, name))
+			}
+		}
+		for name := range settings {
+			if !present[name] {
+				ws = append(ws, fmt.Sprintf("cluster setting %s does not exist", name))
+			}
+		}
+		sort.Strings(ws)
+		for _, w := range ws {
+			warnf("%s on %s", w, destBranch.branch)
+		}
+		warnings[destBranch.branch] = ws
+	}
+	return warnings, nil
+}
+
+// referencedNames returns the exported identifiers of other packages, mapped
+// to their package names, and the cluster settings that the lines added by
+// commits refer to. Identifiers that the commits declare themselves are
+// excluded.
+func referencedNames(commits []string) (symbols map[string]string, settings map[string]bool, err error) {
+	symbols, settings = map[string]string{}, map[string]bool{}
+	declared := map[string]bool{}
+	for _, sha := range commits {
+		out, err := capture("git", "show", "--format=", "-U0", sha, "--", "*.go", "*.sql", "*.test")
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading diff of %.10s: %w", sha, err)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if !strings.HasPrefix(line, "+") || strings.HasPrefix(line, "+++") {
+				continue
+			}
+			line = line[1:]
+			if m := declRE.FindStringSubmatch(line); m != nil && m[1] != "" {
+				declared[m[1]] = true
+			}
+			for _, m := range selectorRE.FindAllStringSubmatch(line, -1) {
+				symbols[m[2]] = m[1]
+			}
+			for _, m := range clusterSettingRE.FindAllStringSubmatch(line, -1) {
+				settings[strings.ToLower(m[1])] = true
+			}
+		}
+	}
+	for name := range declared {
+		delete(symbols, name)
+	}
+	return symbols, settings, nil
+}
+
+// grepTree reports which of the names occur as whole words anywhere in the
+// specified tree.
+func grepTree(tree string, names []string) (map[string]bool, error) {
+	present := map[string]bool{}
+	if len(names) == 0 {
+		return present, nil
+	}
+	args := []string{"git", "grep", "-h", "-o", "-w", "-F"}
+	for _, name := range names {
+		args = append(args, "-e", name)
+	}
+	out, err := capture(append(args, tree)...)
+	if err != nil {
+		// git grep also fails when nothing matches, which is only an error
+		// if the tree itself is bad.
+		if _, verifyErr := capture("git", "rev-parse", "--verify", tree); verifyErr != nil {
+			return nil, fmt.Errorf("searching %s: %w", tree, err)
+		}
+		return present, nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		present[line] = true
+	}
+	return present, nil
+}
@@ -0,0 +1,195 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// labeledPRCount is how many of the most recently merged PRs labeled for a
+// release are suggested.
+const labeledPRCount = 30
+
+// labeledPRs returns the PRs merged to master most recently that are labeled
+// for backport to releaseBranch, e.g. with backport-23.1.x for release-23.1.
+func labeledPRs(ctx context.Context, c config, releaseBranch string) ([]github.Issue, error) {
+	label := backportLabel(strings.TrimPrefix(releaseBranch, "release-"))
+	query := fmt.Sprintf("repo:%s/%s is:pr is:merged base:master label:%q", c.upstreamOwner, c.upstreamRepo, label)
+	res, _, err := c.ghClient.Search.Issues(ctx, query, &github.SearchOptions{
+		Sort:        "updated",
+		Order:       "desc",
+		ListOptions: github.ListOptions{PerPage: labeledPRCount},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searching pull requests (%s): %w", query, err)
+	}
+	return res.Issues, nil
+}
+
+// runCompletePRs prints the PRs that completion suggests for a backport to
+// release, or to the latest release if it is empty, one per line as the PR
+// number and its title, separated by a tab.
+func runCompletePRs(ctx context.Context, release string) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	branch, err := resolveRelease(ctx, c, release)
+	if err != nil {
+		return err
+	}
+	issues, err := labeledPRs(ctx, c, branch)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Printf("%d\t%s\n", issue.GetNumber(), issue.GetTitle())
+	}
+	return nil
+}
+
+// runCompleteReleases prints the releases that completion suggests for
+// --release: the aliases and the releases of the series branches.
+func runCompleteReleases(ctx context.Context) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	branches, err := listReleaseBranches(ctx, c)
+	if err != nil {
+		return err
+	}
+	fmt.Println("stable\nprev")
+	for _, branch := range seriesBranches(branches) {
+		fmt.Println(strings.TrimPrefix(branch, "release-"))
+	}
+	return nil
+}
+
+// completionScript returns the script that sets up completion of backport in
+// shell, which completes the given subcommands and flags, releases after
+// --release, and PR numbers from 'backport completion prs'.
+func completionScript(shell string, commands, flags []string) (string, error) {
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(bashCompletion, strings.Join(flags, " "), strings.Join(commands, " ")), nil
+	case "zsh":
+		return fmt.Sprintf(zshCompletion, strings.Join(flags, " "), strings.Join(commands, " ")), nil
+	case "fish":
+		var flagLines strings.Builder
+		for _, flag := range flags {
+			if strings.HasPrefix(flag, "--") {
+				fmt.Fprintf(&flagLines, "complete -c backport -l %s\n", strings.TrimPrefix(flag, "--"))
+			} else {
+				fmt.Fprintf(&flagLines, "complete -c backport -s %s\n", strings.TrimPrefix(flag, "-"))
+			}
+		}
+		return fmt.Sprintf(fishCompletion, flagLines.String(), strings.Join(commands, " ")), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q; expected bash, zsh, or fish", shell)
+	}
+}
+
+func runCompletion(shell string, commands, flags []string) error {
+	script, err := completionScript(shell, commands, flags)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(os.Stdout, script)
+	return err
+}
+
+const bashCompletion = `# bash completion for backport. To enable it, add this to ~/.bashrc:
+#
+#     source <(backport completion bash)
+
+_backport() {
+    local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+    case $prev in
+    -r|--release)
+        COMPREPLY=($(compgen -W "$(backport completion releases 2>/dev/null)" -- "$cur"))
+        return
+        ;;
+    esac
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+        return
+    fi
+    local release= commands= i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case ${COMP_WORDS[i]} in
+        -r|--release) release=${COMP_WORDS[i+1]} ;;
+        --release=*) release=${COMP_WORDS[i]#--release=} ;;
+        esac
+    done
+    if ((COMP_CWORD == 1)); then
+        commands="%s"
+    fi
+    COMPREPLY=($(compgen -W "$commands $(backport completion prs "$release" 2>/dev/null | cut -f1)" -- "$cur"))
+}
+
+complete -F _backport backport
+`
+
+const zshCompletion = `# zsh completion for backport. To enable it, add this to ~/.zshrc, after
+# compinit:
+#
+#     source <(backport completion zsh)
+
+_backport() {
+    local release i
+    local -a prs
+    case $words[CURRENT-1] in
+    -r|--release)
+        compadd -- ${(f)"$(backport completion releases 2>/dev/null)"}
+        return
+        ;;
+    esac
+    if [[ $PREFIX == -* ]]; then
+        compadd -- %s
+        return
+    fi
+    for ((i = 2; i < CURRENT; i++)); do
+        case $words[i] in
+        -r|--release) release=$words[i+1] ;;
+        --release=*) release=${words[i]#--release=} ;;
+        esac
+    done
+    if ((CURRENT == 2)); then
+        compadd -- %s
+    fi
+    prs=(${(f)"$(backport completion prs "$release" 2>/dev/null | tr '\t' :)"})
+    _describe 'pull request' prs
+}
+
+compdef _backport backport
+`
+
+const fishCompletion = `# fish completion for backport. To enable it, run:
+#
+#     backport completion fish > ~/.config/fish/completions/backport.fish
+
+function __backport_release
+    set -l tokens (commandline -opc)
+    set -l release
+    for i in (seq (count $tokens))
+        switch $tokens[$i]
+            case -r --release
+                if test $i -lt (count $tokens)
+                    set release $tokens[(math $i + 1)]
+                end
+            case '--release=*'
+                set release (string replace -- --release= '' $tokens[$i])
+        end
+    end
+    echo $release
+end
+
+complete -c backport -f
+%scomplete -c backport -s r -l release -x -a '(backport completion releases 2>/dev/null)'
+complete -c backport -n __fish_use_subcommand -a '%s'
+complete -c backport -a '(backport completion prs (__backport_release) 2>/dev/null)'
+`
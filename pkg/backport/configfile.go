@@ -0,0 +1,75 @@
+package backport
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// sharedConfigFile is the name of the per-repository configuration file,
+// which is looked up at the top level of the working tree. Like the global
+// configuration file, it uses Git's configuration syntax, e.g.:
+//
+//	[backport]
+//		upstream = cockroachdb/cockroach
+//		releaseBranchPattern = ^release-
+const sharedConfigFile = ".backportrc"
+
+// untrustedKeys are the options that are ignored in the per-repository
+// configuration file, since the file comes with the repository and these
+// options could otherwise be used to run arbitrary commands, to send the
+// GitHub token, or Git credentials, elsewhere, to commit as someone else, or
+// to publish any file, e.g. one holding credentials, as a PR body.
+var untrustedKeys = map[string]bool{
+	"cockroach.githubToken": true,
+	"backport.githubAPI":    true,
+	"backport.githubUpload": true,
+	"backport.lint":         true,
+	"backport.defaultFlags": true,
+	"backport.pushURL":      true,
+	"backport.committer":    true,
+	"backport.template":     true,
+}
+
+// globalConfigFile returns the path of the user's backport configuration
+// file, $XDG_CONFIG_HOME/backport/config.
+func globalConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "backport", "config")
+}
+
+// configSources returns the arguments that select each source of
+// configuration for key, from highest to lowest precedence: Git's own
+// configuration, the per-repository .backportrc, and the global configuration
+// file.
+func configSources(key string) [][]string {
+	sources := [][]string{nil}
+	if !untrustedKeys[key] {
+		if top, err := capture("git", "rev-parse", "--show-toplevel"); err == nil {
+			sources = append(sources, []string{"--file", filepath.Join(top, sharedConfigFile)})
+		}
+	}
+	if path := globalConfigFile(); path != "" {
+		sources = append(sources, []string{"--file", path})
+	}
+	return sources
+}
+
+// lookupConfig runs 'git config <args> key' against each configuration
+// source in turn and returns the first non-empty result.
+func lookupConfig(key string, args ...string) string {
+	for _, source := range configSources(key) {
+		cmd := append([]string{"git", "config"}, source...)
+		cmd = append(cmd, args...)
+		if v, _ := capture(append(cmd, key)...); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backportCoverage records a branch that already contains a change, and the
+// PR that put it there.
+type backportCoverage struct {
+	branch string
+	number int
+}
+
+// loadCoverage records, for each merged PR, the release branches that its
+// merged backports have already brought the change to.
+func (prs pullRequests) loadCoverage(ctx context.Context, c config) error {
+	for i := range prs {
+		pr := &prs[i]
+		if pr.mergeCommit == "" {
+			continue
+		}
+		backports, err := findBackports(ctx, c, "is:merged", pr.number, "")
+		if err != nil {
+			return err
+		}
+		for _, bp := range backports {
+			ghPR, _, err := c.ghClient.PullRequests.Get(ctx, c.upstreamOwner, c.upstreamRepo, bp.GetNumber())
+			if err != nil {
+				return fmt.Errorf("fetching PR #%d: %w", bp.GetNumber(), err)
+			}
+			pr.coverage = append(pr.coverage, backportCoverage{
+				branch: ghPR.GetBase().GetRef(),
+				number: bp.GetNumber(),
+			})
+		}
+		sort.Slice(pr.coverage, func(i, j int) bool {
+			return pr.coverage[i].branch < pr.coverage[j].branch
+		})
+	}
+	return nil
+}
+
+// mergeSummary describes when pr merged and which release branches already
+// contain it, e.g. "#123 merged to master on 2024-01-02 and is already in
+// release-23.2 (#456)." It is empty if pr has not merged.
+func (pr pullRequest) mergeSummary() string {
+	if pr.mergedAt.IsZero() {
+		return ""
+	}
+	s := fmt.Sprintf("#%d merged to %s on %s", pr.number, pr.baseBranch, pr.mergedAt.UTC().Format("2006-01-02"))
+	if len(pr.coverage) == 0 {
+		return s + "."
+	}
+	var in []string
+	for _, cov := range pr.coverage {
+		in = append(in, fmt.Sprintf("%s (#%d)", cov.branch, cov.number))
+	}
+	return fmt.Sprintf("%s and is already in %s.", s, strings.Join(in, ", "))
+}
+
+// printMergeSummaries notes when each PR merged and where it was backported.
+func (prs pullRequests) printMergeSummaries() {
+	for _, pr := range prs {
+		if summary := pr.mergeSummary(); summary != "" {
+			ago := time.Since(pr.mergedAt)
+			infof("Note: %s (%s ago)", strings.TrimSuffix(summary, "."), formatAge(ago))
+		}
+	}
+}
+
+// formatAge formats d in days, or in hours if less than two days.
+func formatAge(d time.Duration) string {
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
@@ -0,0 +1,83 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// dangerousPaths returns the files touched by commits that lie under one of
+// the paths in the multi-valued backport.dangerousPath option, e.g.
+// pkg/clusterversion or pkg/upgrade/*.go, along with the option value each
+// one matched. The commits must be available locally.
+func dangerousPaths(commits []string) (map[string]string, error) {
+	patterns := gitConfigAll("backport.dangerousPath")
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	matched := map[string]string{}
+	for _, sha := range commits {
+		out, err := capture("git", "diff-tree", "--no-commit-id", "--name-only", "-r", sha)
+		if err != nil {
+			return nil, fmt.Errorf("listing files touched by commit %s: %w", sha, err)
+		}
+		for _, file := range strings.Fields(out) {
+			for _, pattern := range patterns {
+				pattern = strings.TrimSuffix(pattern, "/")
+				ok, err := path.Match(pattern, file)
+				if err != nil {
+					return nil, fmt.Errorf("malformed backport.dangerousPath %q: %w", pattern, err)
+				}
+				if ok || strings.HasPrefix(file, pattern+"/") {
+					matched[file] = pattern
+					break
+				}
+			}
+		}
+	}
+	return matched, nil
+}
+
+// checkDangerousPaths warns loudly if commits touch any of the paths listed in
+// backport.dangerousPath, where bad backports do the most harm, and requires
+// confirming the backport at a prompt, or --force if there is no terminal.
+// Dry runs merely warn.
+func checkDangerousPaths(commits []string, dryRun bool) error {
+	matched, err := dangerousPaths(commits)
+	if err != nil || len(matched) == 0 {
+		return err
+	}
+	var files []string
+	for file := range matched {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var list strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&list, "\n    %s (%s)", file, matched[file])
+	}
+	msg := fmt.Sprintf("this backport touches paths that are marked as dangerous to backport:%s", list.String())
+	if force || dryRun {
+		warnf("%s", msg)
+		return nil
+	}
+	if !isInteractive() {
+		return hintedErr{
+			error: errors.New(msg),
+			hint: `backports to these paths have caused the worst outages. Make sure the
+change is safe for the release, e.g. with the owners of these paths, then
+rerun with --force.`,
+		}
+	}
+	warnf("%s\n\nBackports to these paths have caused the worst outages. Make sure the\nchange is safe for the release.", msg)
+	answer, err := prompt("Backport anyway? [y/N] ")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.ToLower(answer), "y") {
+		return errors.New("backport cancelled")
+	}
+	return nil
+}
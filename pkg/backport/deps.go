@@ -0,0 +1,262 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// prerequisite is an upstream PR that a backport appears to depend on.
+type prerequisite struct {
+	number  int      // 0 if the commits could not be attributed to a PR
+	title   string   //
+	commits []string // the commits in the PR that the backport depends on
+}
+
+var hunkRE = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? `)
+
+// findPrerequisites identifies the commits that the specified commits depend
+// on but that are absent from destRef. A commit is considered a dependency if
+// it last modified any of the lines changed by one of the specified commits and
+// was made after the point at which destRef diverged. Commits in ignore, e.g.,
+// because they are already part of the backport, are never reported.
+func findPrerequisites(
+	ctx context.Context, c config, commits []string, destRef string, ignore map[string]bool,
+) ([]prerequisite, error) {
+	var deps []string
+	seen := map[string]bool{}
+	for _, commit := range commits {
+		base, err := capture("git", "merge-base", destRef, commit)
+		if err != nil {
+			return nil, fmt.Errorf("finding merge base of %s and %s: %w", destRef, commit, err)
+		}
+		blamed, err := blameChangedLines(commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, sha := range blamed {
+			if seen[sha] || ignore[sha] {
+				continue
+			}
+			seen[sha] = true
+			if _, err := capture("git", "merge-base", "--is-ancestor", sha, base); err == nil {
+				// Already present on the destination branch.
+				continue
+			}
+			deps = append(deps, sha)
+		}
+	}
+	if len(deps) == 0 {
+		return nil, nil
+	}
+
+	// Sort the dependencies from oldest to newest, so that they can be
+	// cherry-picked in order.
+	out, err := capture(append([]string{"git", "rev-list", "--no-walk=sorted", "--reverse"}, deps...)...)
+	if err != nil {
+		return nil, fmt.Errorf("sorting prerequisite commits: %w", err)
+	}
+	deps = strings.Fields(out)
+
+	var prereqs []prerequisite
+	byPR := map[int]int{} // PR number -> index into prereqs
+	for _, sha := range deps {
+		number, title := commitPR(ctx, c, sha)
+		if i, ok := byPR[number]; ok && number != 0 {
+			prereqs[i].commits = append(prereqs[i].commits, sha)
+			continue
+		}
+		byPR[number] = len(prereqs)
+		prereqs = append(prereqs, prerequisite{number: number, title: title, commits: []string{sha}})
+	}
+	return prereqs, nil
+}
+
+// blameChangedLines returns the commits that last touched, as of its parent,
+// the lines that commit changes.
+func blameChangedLines(commit string) ([]string, error) {
+	diff, err := capture("git", "diff", "--no-renames", "-U0", commit+"^", commit)
+	if err != nil {
+		return nil, fmt.Errorf("diffing %s: %w", commit, err)
+	}
+	var blamed []string
+	var file string
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "--- ") {
+			file = strings.TrimPrefix(line, "--- a/")
+			if line == "--- /dev/null" {
+				file = ""
+			}
+			continue
+		}
+		m := hunkRE.FindStringSubmatch(line)
+		if m == nil || file == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if count == 0 {
+			// A pure insertion after line start. Blame the line it follows.
+			if start == 0 {
+				continue
+			}
+			count = 1
+		}
+		out, err := capture("git", "blame", "--porcelain",
+			"-L", fmt.Sprintf("%d,+%d", start, count), commit+"^", "--", file)
+		if err != nil {
+			return nil, fmt.Errorf("blaming %s in %s^: %w", file, commit, err)
+		}
+		for _, l := range strings.Split(out, "\n") {
+			if f := strings.Fields(l); len(f) >= 3 && len(f[0]) == 40 && !strings.HasPrefix(l, "\t") {
+				blamed = append(blamed, f[0])
+			}
+		}
+	}
+	return blamed, nil
+}
+
+// commitPR returns the number and title of the merged upstream PR that
+// introduced the specified commit, or zero if it cannot be determined.
+func commitPR(ctx context.Context, c config, sha string) (int, string) {
+	prs, _, err := c.ghClient.PullRequests.ListPullRequestsWithCommit(ctx, c.upstreamOwner, c.upstreamRepo, sha, nil)
+	if err != nil {
+		return 0, ""
+	}
+	for _, pr := range prs {
+		if pr.GetMergedAt().IsZero() {
+			continue
+		}
+		return pr.GetNumber(), pr.GetTitle()
+	}
+	return 0, ""
+}
+
+// printPrerequisites describes prereqs on stdout, using subjects for commits
+// that could not be attributed to a PR.
+func printPrerequisites(prereqs []prerequisite) {
+	for _, p := range prereqs {
+		if p.number != 0 {
+			infof("    #%d  %s", p.number, p.title)
+		} else {
+			for _, sha := range p.commits {
+				subject, _ := capture("git", "show", "-s", "--format=%s", sha)
+				infof("    %.10s  %s (no PR found)", sha, subject)
+			}
+		}
+	}
+}
+
+// offerPrerequisites is called when the cherry-pick of a backport stopped on a
+// conflict. It looks for PRs that the conflicting commit depends on and, if
+// stdin is a terminal, offers to restart the backport with them prepended. It
+// returns the PRs to prepend, if any.
+func offerPrerequisites(ctx context.Context, c config, prs pullRequests) ([]int, error) {
+	if ok, err := isCherryPicking(); err != nil || !ok {
+		return nil, err
+	}
+	conflicting, err := capture("git", "rev-parse", "CHERRY_PICK_HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("looking up conflicting commit: %w", err)
+	}
+	ignore := map[string]bool{}
+	for _, commit := range prs.selectedCommits() {
+		ignore[commit] = true
+	}
+	prereqs, err := findPrerequisites(ctx, c, []string{conflicting}, "HEAD", ignore)
+	if err != nil || len(prereqs) == 0 {
+		return nil, err
+	}
+
+	infof("The conflicting commit %.10s may depend on changes that are not on the\nrelease branch yet:", conflicting)
+	printPrerequisites(prereqs)
+
+	var prNos []int
+	for _, p := range prereqs {
+		if p.number != 0 {
+			prNos = append(prNos, p.number)
+		}
+	}
+	if len(prNos) == 0 || !isInteractive() {
+		return nil, nil
+	}
+	answer, err := prompt(fmt.Sprintf("Restart the backport with %s prepended? [y/N] ", formatPRNumbers(prNos)))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.ToLower(answer), "y") {
+		return nil, nil
+	}
+	return prNos, nil
+}
+
+// runDeps reports the upstream commits and PRs that the specified PRs depend
+// on but that are missing from the target release branches, without
+// modifying the repository.
+func runDeps(ctx context.Context, prArgs []string, opts Options) error {
+	if len(prArgs) == 0 {
+		return UsageError{errors.New("deps requires at least one pull request")}
+	}
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	prNos, err := parsePRArgs(c, prArgs)
+	if err != nil {
+		return err
+	}
+
+	pullRequests, err := loadPullRequests(ctx, c, prNos)
+	if err != nil {
+		return err
+	}
+	if err := pullRequests.selectCommits(opts.Commits); err != nil {
+		return err
+	}
+	if err := pullRequests.grepCommits(opts.Greps); err != nil {
+		return err
+	}
+
+	destBranches, err := getDestinationBranches(ctx, c, opts.Releases, opts.Branch)
+	if err != nil {
+		return err
+	}
+
+	err = fetchBranches(c, "master")
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", "master", err)
+	}
+
+	commits := pullRequests.selectedCommits()
+	ignore := map[string]bool{}
+	for _, commit := range commits {
+		ignore[commit] = true
+	}
+	for i, destBranch := range destBranches {
+		err := fetchBranches(c, destBranch.branch)
+		if err != nil {
+			return fmt.Errorf("fetching %q branch: %w", destBranch.branch, err)
+		}
+		prereqs, err := findPrerequisites(ctx, c, commits, "FETCH_HEAD", ignore)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			renderer.Info("")
+		}
+		if len(prereqs) == 0 {
+			infof("No missing dependencies found on %s.", destBranch.branch)
+			continue
+		}
+		infof("Changes missing from %s that the backport depends on:", destBranch.branch)
+		printPrerequisites(prereqs)
+	}
+	return nil
+}
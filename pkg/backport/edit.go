@@ -0,0 +1,54 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// editMessage opens the title and body of the PR in backportURL in the user's
+// editor, as configured for Git, and returns backportURL with the edited
+// title and body. The title is the first line of the edited text, and the
+// body is the rest, after a blank line.
+func editMessage(c config, backportURL string) (string, error) {
+	u, err := url.Parse(backportURL)
+	if err != nil {
+		return "", fmt.Errorf("malformatted url file: %w", err)
+	}
+	query := u.Query()
+
+	path := filepath.Join(c.gitDir, "BACKPORT_EDITMSG")
+	text := query.Get("title") + "\n\n" + strings.TrimRight(query.Get("body"), "\n") + "\n"
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", fmt.Errorf("writing PR message: %w", err)
+	}
+	editor, err := capture("git", "var", "GIT_EDITOR")
+	if err != nil {
+		return "", fmt.Errorf("looking up editor: %w", err)
+	}
+	// Like Git, let the shell interpret the editor command.
+	if err := spawn("sh", "-c", editor+` "$@"`, editor, path); err != nil {
+		return "", fmt.Errorf("running editor %q: %w", editor, err)
+	}
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading PR message: %w", err)
+	}
+
+	parts := strings.SplitN(strings.TrimLeft(string(in), "\n"), "\n", 2)
+	title := strings.TrimSpace(parts[0])
+	if title == "" {
+		return "", errors.New("aborting backport due to empty PR title")
+	}
+	var body string
+	if len(parts) == 2 {
+		body = strings.Trim(parts[1], "\n") + "\n"
+	}
+	query.Set("title", title)
+	query.Set("body", body)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -1,4 +1,4 @@
-package main
+package backport
 
 import (
 	"bytes"
@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // capture executes the command specified by args and returns its stdout. If
 // the process exits with a failing exit code, capture instead returns an error
 // which includes the process's stderr.
 func capture(args ...string) (string, error) {
+	return captureWithInput("", args...)
+}
+
+// captureWithInput is like capture, but feeds input to the process's stdin.
+func captureWithInput(input string, args ...string) (string, error) {
 	var cmd *exec.Cmd
 	if len(args) == 0 {
 		panic("capture called with no arguments")
@@ -20,6 +26,7 @@ func capture(args ...string) (string, error) {
 	} else {
 		cmd = exec.Command(args[0], args[1:]...)
 	}
+	cmd.Stdin = strings.NewReader(input)
 	out, err := cmd.Output()
 	if err != nil {
 		var exitErr *exec.ExitError
@@ -47,6 +54,10 @@ func spawn(args ...string) error {
 	}
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
+	if _, ok := renderer.(JSONRenderer); ok {
+		// Keep stdout parseable.
+		cmd.Stdout = os.Stderr
+	}
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
@@ -0,0 +1,74 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// findFollowUps searches master for merged PRs that describe themselves as
+// fixing or following up on one of prs, e.g., "Fixes a regression from
+// #12345", and that are not already part of the backport.
+func findFollowUps(ctx context.Context, c config, prs pullRequests) ([]int, map[int]string, error) {
+	included := map[int]bool{}
+	for _, pr := range prs {
+		included[pr.number] = true
+	}
+	var followUps []int
+	titles := map[int]string{}
+	for _, pr := range prs {
+		if pr.isRaw() {
+			continue
+		}
+		results, err := searchPullRequests(ctx, c, fmt.Sprintf("is:merged base:master %d", pr.number))
+		if err != nil {
+			return nil, nil, err
+		}
+		re := regexp.MustCompile(fmt.Sprintf(
+			`(?i)\b(fix|fixes|fixed|follow[- ]?up|regression|broken|introduced)\b[^\n]*#%d\b`, pr.number))
+		for _, result := range results {
+			n := result.GetNumber()
+			if included[n] || !re.MatchString(result.GetTitle()+"\n"+result.GetBody()) {
+				continue
+			}
+			included[n] = true
+			followUps = append(followUps, n)
+			titles[n] = result.GetTitle()
+		}
+	}
+	return followUps, titles, nil
+}
+
+// offerFollowUps looks for follow-up fixes to prs and, if stdin is a
+// terminal, offers to add each of them to the backport. Otherwise, it merely
+// warns about them. It returns the PRs to add.
+func offerFollowUps(ctx context.Context, c config, prs pullRequests) ([]int, error) {
+	followUps, titles, err := findFollowUps(ctx, c, prs)
+	if err != nil {
+		warnf("unable to search for follow-up PRs: %s", err)
+		return nil, nil
+	}
+	if len(followUps) == 0 {
+		return nil, nil
+	}
+	if !isInteractive() {
+		msg := "the following PRs look like follow-up fixes and are not included:"
+		for _, n := range followUps {
+			msg += fmt.Sprintf("\n    #%d  %s", n, titles[n])
+		}
+		renderer.Warn(msg)
+		return nil, nil
+	}
+	var accepted []int
+	for _, n := range followUps {
+		answer, err := prompt(fmt.Sprintf("#%d (%s) looks like a follow-up fix. Include it? [y/N] ", n, titles[n]))
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(strings.ToLower(answer), "y") {
+			accepted = append(accepted, n)
+		}
+	}
+	return accepted, nil
+}
@@ -0,0 +1,97 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// verifyFork checks via the API that the repository that backports are pushed
+// to is a fork of the upstream repository, possibly via another fork, and, if
+// the API reports permissions, that the user may push to it. Remotes that
+// merely have a similar name, or forks that the user cannot push to, would
+// otherwise only fail once the backport is ready to be pushed or opened.
+func verifyFork(ctx context.Context, c config) error {
+	name := c.username + "/" + c.forkRepo
+	upstream := c.upstreamOwner + "/" + c.upstreamRepo
+	repo, res, err := c.ghClient.Repositories.Get(ctx, c.username, c.forkRepo)
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			return hintedErr{
+				error: fmt.Errorf("remote %q points to %s, which does not exist on GitHub", c.remote, name),
+				hint: fmt.Sprintf(`fork %s on GitHub and point the remote to your fork, or name
+its owner with 'git config backport.forkOwner USERNAME'.`, upstream),
+			}
+		}
+		return fmt.Errorf("looking up %s: %w", name, err)
+	}
+	if !repo.GetFork() {
+		return fmt.Errorf("remote %q points to %s, which is not a fork of %s", c.remote, name, upstream)
+	}
+	parent, source := repo.GetParent().GetFullName(), repo.GetSource().GetFullName()
+	if !strings.EqualFold(parent, upstream) && !strings.EqualFold(source, upstream) {
+		return fmt.Errorf("remote %q points to %s, which is a fork of %s rather than %s",
+			c.remote, name, parent, upstream)
+	}
+	if perms := repo.GetPermissions(); perms != nil && !perms["push"] {
+		return hintedErr{
+			error: fmt.Errorf("you do not have push access to %s", name),
+			hint: `check that the GitHub token belongs to the owner of the fork, or
+to a collaborator on it.`,
+		}
+	}
+	return nil
+}
+
+// forkNamedDifferently returns whether the fork's name differs from the
+// upstream repository's, as is common for forks of forks. Its owner may then
+// own several repositories in the upstream's fork network, e.g. an
+// organization's own fork and the fork of it that backports are pushed to,
+// so that the owner alone does not identify the repository of a branch.
+func (c config) forkNamedDifferently() bool {
+	return !strings.EqualFold(c.forkRepo, c.upstreamRepo)
+}
+
+// compareHead returns the head of a compare URL for branch in the fork, e.g.
+// owner:branch, or owner:repo:branch if the owner does not identify the fork.
+func (c config) compareHead(branch string) string {
+	if c.forkNamedDifferently() {
+		return c.username + ":" + c.forkRepo + ":" + branch
+	}
+	return c.username + ":" + branch
+}
+
+// newPullRequest adds to github.NewPullRequest the head_repo field, which
+// names the repository of the head branch when its owner is ambiguous.
+type newPullRequest struct {
+	github.NewPullRequest
+	HeadRepo string `json:"head_repo,omitempty"`
+}
+
+// createPullRequest creates a PR upstream for branch in the fork, naming the
+// fork explicitly if its owner does not identify it.
+func createPullRequest(
+	ctx context.Context, c config, branch string, pr github.NewPullRequest,
+) (*github.PullRequest, error) {
+	pr.Head = github.String(c.username + ":" + branch)
+	body := newPullRequest{NewPullRequest: pr}
+	if c.forkNamedDifferently() {
+		body.HeadRepo = c.forkRepo
+	}
+	req, err := c.ghClient.NewRequest("POST",
+		fmt.Sprintf("repos/%s/%s/pulls", c.upstreamOwner, c.upstreamRepo), body)
+	if err != nil {
+		return nil, err
+	}
+	// Draft PRs are in preview in this version of the API, as in
+	// PullRequests.Create.
+	req.Header.Set("Accept", "application/vnd.github.shadow-cat-preview+json")
+	created := new(github.PullRequest)
+	if _, err := c.ghClient.Do(ctx, req, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
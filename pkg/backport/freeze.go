@@ -0,0 +1,72 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// freezeWindow is a period during which a release branch is closed to
+// backports, e.g., in the run-up to a point release.
+type freezeWindow struct {
+	branch     string
+	start, end time.Time // inclusive dates
+}
+
+// loadFreezeCalendar parses the backport.freeze Git config option. Each value
+// is of the form "BRANCH START END", where START and END are dates formatted as
+// YYYY-MM-DD, e.g., "release-23.1 2024-01-08 2024-01-15".
+func loadFreezeCalendar() ([]freezeWindow, error) {
+	var windows []freezeWindow
+	for _, v := range gitConfigAll("backport.freeze") {
+		fields := strings.Fields(v)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed backport.freeze entry %q; expected \"BRANCH START END\"", v)
+		}
+		start, err := time.ParseInLocation("2006-01-02", fields[1], time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("malformed backport.freeze entry %q: %w", v, err)
+		}
+		end, err := time.ParseInLocation("2006-01-02", fields[2], time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("malformed backport.freeze entry %q: %w", v, err)
+		}
+		windows = append(windows, freezeWindow{branch: fields[0], start: start, end: end})
+	}
+	return windows, nil
+}
+
+// activeFreeze returns the freeze window that applies to branch at time t, if
+// any.
+func activeFreeze(windows []freezeWindow, branch string, t time.Time) (freezeWindow, bool) {
+	for _, w := range windows {
+		if w.branch == branch && !t.Before(w.start) && t.Before(w.end.AddDate(0, 0, 1)) {
+			return w, true
+		}
+	}
+	return freezeWindow{}, false
+}
+
+// checkFreeze refuses to backport to a branch that is in code freeze unless
+// --force is specified, in which case it merely warns.
+func checkFreeze(destBranch *destinationBranch) error {
+	windows, err := loadFreezeCalendar()
+	if err != nil {
+		return err
+	}
+	w, ok := activeFreeze(windows, destBranch.branch, time.Now())
+	if !ok {
+		return nil
+	}
+	msg := fmt.Sprintf("%s is in code freeze until %s", w.branch, w.end.Format("2006-01-02"))
+	if force {
+		warnf("%s", msg)
+		return nil
+	}
+	return hintedErr{
+		error: errors.New(msg),
+		hint: `backports to frozen branches usually need sign-off from the release
+manager. If you have it, rerun with --force.`,
+	}
+}
@@ -0,0 +1,173 @@
+package backport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// graphQLError is an error reported in the body of a GraphQL response. Path
+// leads to the field of the query that failed, if any.
+type graphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path"`
+}
+
+// graphQL runs query with the given variables against the GitHub GraphQL API
+// and decodes the data of the response into data. The errors reported in the
+// response are returned alongside the data, which is decoded even if there
+// are some, as fields that did not fail are still filled in.
+//
+// The GraphQL API requires authentication. Only queries are sent, which are
+// retried like GET requests.
+func graphQL(
+	ctx context.Context, c config, query string, vars map[string]interface{}, data interface{},
+) ([]graphQLError, error) {
+	// The GraphQL endpoint is api.github.com/graphql on GitHub.com and
+	// HOST/api/graphql on GitHub Enterprise Server, whose REST API lives at
+	// HOST/api/v3/.
+	endpoint := "graphql"
+	if strings.HasSuffix(c.ghClient.BaseURL.Path, "/api/v3/") {
+		endpoint = "../graphql"
+	}
+	req, err := c.ghClient.NewRequest("POST", endpoint, map[string]interface{}{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []graphQLError  `json:"errors"`
+	}
+	if _, err := c.ghClient.Do(readOnly(ctx), req, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) > 0 {
+		if err := json.Unmarshal(res.Data, data); err != nil {
+			return nil, fmt.Errorf("decoding GraphQL response: %w", err)
+		}
+	}
+	return res.Errors, nil
+}
+
+// graphQLPR is a pull request as fetched by loadPullRequestsGraphQL.
+type graphQLPR struct {
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	BaseRefName string     `json:"baseRefName"`
+	Merged      bool       `json:"merged"`
+	MergedAt    *time.Time `json:"mergedAt"`
+	Author      *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	MergeCommit *struct {
+		OID string `json:"oid"`
+	} `json:"mergeCommit"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Commits struct {
+		Nodes []struct {
+			Commit struct {
+				OID     string `json:"oid"`
+				Message string `json:"message"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+// graphQLPRFields are the fields of graphQLPR. Like the REST API, which lists
+// no more than 250 commits of a PR, it only asks for that many.
+const graphQLPRFields = `fragment pr on PullRequest {
+  number
+  title
+  body
+  baseRefName
+  merged
+  mergedAt
+  author { login }
+  mergeCommit { oid }
+  labels(first: 100) { nodes { name } }
+  commits(first: 250) { nodes { commit { oid message } } }
+}`
+
+// loadPullRequestsGraphQL is like loadPullRequests, but fetches all of the
+// PRs in a single GraphQL query, rather than with two REST API requests per
+// PR, which adds up when backporting many PRs at once.
+func loadPullRequestsGraphQL(ctx context.Context, c config, prNos []int) (pullRequests, error) {
+	// A query for no PRs would select nothing from the repository, which is
+	// invalid, e.g. with --sha.
+	if len(prNos) == 0 {
+		return nil, nil
+	}
+	var query strings.Builder
+	query.WriteString("query($owner: String!, $repo: String!) {\n  repository(owner: $owner, name: $repo) {\n")
+	seen := map[int]bool{}
+	for _, prNo := range prNos {
+		if !seen[prNo] {
+			seen[prNo] = true
+			fmt.Fprintf(&query, "    pr%d: pullRequest(number: %[1]d) { ...pr }\n", prNo)
+		}
+	}
+	query.WriteString("  }\n}\n" + graphQLPRFields)
+
+	var data struct {
+		Repository map[string]*graphQLPR `json:"repository"`
+	}
+	errs, err := graphQL(ctx, c, query.String(), map[string]interface{}{
+		"owner": c.upstreamOwner,
+		"repo":  c.upstreamRepo,
+	}, &data)
+	if err != nil {
+		return nil, fmt.Errorf("fetching PRs: %w", err)
+	}
+	for _, e := range errs {
+		if len(e.Path) >= 2 {
+			if alias, ok := e.Path[1].(string); ok && strings.HasPrefix(alias, "pr") {
+				return nil, fmt.Errorf("fetching PR #%s: %s", strings.TrimPrefix(alias, "pr"), e.Message)
+			}
+		}
+		return nil, fmt.Errorf("fetching PRs: %s", e.Message)
+	}
+
+	var prs pullRequests
+	for _, prNo := range prNos {
+		ghPR := data.Repository[fmt.Sprintf("pr%d", prNo)]
+		if ghPR == nil {
+			return nil, fmt.Errorf("fetching PR #%d: not found", prNo)
+		}
+		pr := pullRequest{
+			number:     prNo,
+			title:      ghPR.Title,
+			body:       ghPR.Body,
+			baseBranch: ghPR.BaseRefName,
+			messages:   map[string]string{},
+		}
+		if ghPR.Author != nil {
+			pr.author = ghPR.Author.Login
+		}
+		if ghPR.Merged && ghPR.MergeCommit != nil {
+			pr.mergeCommit = ghPR.MergeCommit.OID
+			if ghPR.MergedAt != nil {
+				pr.mergedAt = *ghPR.MergedAt
+			}
+		}
+		for _, l := range ghPR.Labels.Nodes {
+			pr.labels = append(pr.labels, l.Name)
+		}
+		for _, n := range ghPR.Commits.Nodes {
+			pr.commits = append(pr.commits, n.Commit.OID)
+			pr.messages[n.Commit.OID] = n.Commit.Message
+			pr.selectedCommits = append(pr.selectedCommits, n.Commit.OID)
+		}
+		prs = append(prs, pr)
+	}
+	return prs, nil
+}
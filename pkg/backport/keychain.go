@@ -0,0 +1,236 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// keychainService is the service under which the GitHub token is stored in
+// the OS keychain. Tokens are keyed by GitHub host, so that a token for
+// GitHub Enterprise Server can be stored alongside one for github.com.
+const keychainService = "backport"
+
+// keychainName names the credential store used on this OS, for messages.
+func keychainName() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "the macOS Keychain"
+	case "windows":
+		return "the Windows Credential Manager"
+	default:
+		return "the Secret Service keyring"
+	}
+}
+
+// keychainLookup returns the token for host stored by 'backport auth login'.
+func keychainLookup(host string) (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return capture("security", "find-generic-password", "-s", keychainService, "-a", host, "-w")
+	case "windows":
+		return captureWithInput("", windowsCredCmd(fmt.Sprintf("[Console]::Out.Write([BackportCred]::Read(%s))",
+			psQuote(keychainService+":"+host)))...)
+	default:
+		return capture("secret-tool", "lookup", "service", keychainService, "host", host)
+	}
+}
+
+// keychainStore stores token for host. The token is passed on stdin, never
+// as an argument, where other users could see it in the process list.
+func keychainStore(host, token string) error {
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		// security -i reads commands from stdin, split into arguments like
+		// by a shell.
+		if strings.ContainsAny(token, "\r\n") {
+			return errors.New("the token must be on one line")
+		}
+		_, err = captureWithInput(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+			securityQuote(keychainService), securityQuote(host), securityQuote(token)), "security", "-i")
+	case "windows":
+		_, err = captureWithInput(token, windowsCredCmd(fmt.Sprintf("[BackportCred]::Write(%s, [Console]::In.ReadToEnd().Trim())",
+			psQuote(keychainService+":"+host)))...)
+	default:
+		_, err = captureWithInput(token, "secret-tool", "store", "--label=backport GitHub token ("+host+")",
+			"service", keychainService, "host", host)
+	}
+	return err
+}
+
+// keychainDelete deletes the token for host.
+func keychainDelete(host string) error {
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		_, err = capture("security", "delete-generic-password", "-s", keychainService, "-a", host)
+	case "windows":
+		_, err = capture(windowsCredCmd(fmt.Sprintf("[BackportCred]::Delete(%s)",
+			psQuote(keychainService+":"+host)))...)
+	default:
+		_, err = capture("secret-tool", "clear", "service", keychainService, "host", host)
+	}
+	return err
+}
+
+// windowsCredCmd returns a PowerShell command that runs script with access to
+// the Windows Credential Manager through the BackportCred class.
+func windowsCredCmd(script string) []string {
+	return []string{"powershell", "-NoProfile", "-NonInteractive", "-Command",
+		"$ErrorActionPreference = 'Stop'; Add-Type -TypeDefinition @'\n" + windowsCredSource + "\n'@\n" + script}
+}
+
+// securityQuote quotes s as an argument in a command for 'security -i'.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// windowsCredSource wraps the Credential Manager API, which PowerShell does
+// not expose.
+const windowsCredSource = `using System;
+using System.ComponentModel;
+using System.Runtime.InteropServices;
+using System.Text;
+
+public static class BackportCred {
+    [StructLayout(LayoutKind.Sequential, CharSet = CharSet.Unicode)]
+    struct CREDENTIAL {
+        public int Flags;
+        public int Type;
+        public string TargetName;
+        public string Comment;
+        public System.Runtime.InteropServices.ComTypes.FILETIME LastWritten;
+        public int CredentialBlobSize;
+        public IntPtr CredentialBlob;
+        public int Persist;
+        public int AttributeCount;
+        public IntPtr Attributes;
+        public string TargetAlias;
+        public string UserName;
+    }
+
+    const int CRED_TYPE_GENERIC = 1;
+    const int CRED_PERSIST_LOCAL_MACHINE = 2;
+
+    [DllImport("advapi32.dll", CharSet = CharSet.Unicode, SetLastError = true)]
+    static extern bool CredReadW(string target, int type, int flags, out IntPtr cred);
+    [DllImport("advapi32.dll", CharSet = CharSet.Unicode, SetLastError = true)]
+    static extern bool CredWriteW(ref CREDENTIAL cred, int flags);
+    [DllImport("advapi32.dll", CharSet = CharSet.Unicode, SetLastError = true)]
+    static extern bool CredDeleteW(string target, int type, int flags);
+    [DllImport("advapi32.dll")]
+    static extern void CredFree(IntPtr cred);
+
+    public static string Read(string target) {
+        IntPtr p;
+        if (!CredReadW(target, CRED_TYPE_GENERIC, 0, out p)) {
+            throw new Win32Exception();
+        }
+        try {
+            CREDENTIAL c = (CREDENTIAL)Marshal.PtrToStructure(p, typeof(CREDENTIAL));
+            return Marshal.PtrToStringUni(c.CredentialBlob, c.CredentialBlobSize / 2);
+        } finally {
+            CredFree(p);
+        }
+    }
+
+    public static void Write(string target, string secret) {
+        byte[] blob = Encoding.Unicode.GetBytes(secret);
+        CREDENTIAL c = new CREDENTIAL();
+        c.Type = CRED_TYPE_GENERIC;
+        c.TargetName = target;
+        c.Persist = CRED_PERSIST_LOCAL_MACHINE;
+        c.UserName = "backport";
+        c.CredentialBlobSize = blob.Length;
+        c.CredentialBlob = Marshal.AllocCoTaskMem(blob.Length);
+        try {
+            Marshal.Copy(blob, 0, c.CredentialBlob, blob.Length);
+            if (!CredWriteW(ref c, 0)) {
+                throw new Win32Exception();
+            }
+        } finally {
+            Marshal.FreeCoTaskMem(c.CredentialBlob);
+        }
+    }
+
+    public static void Delete(string target) {
+        if (!CredDeleteW(target, CRED_TYPE_GENERIC, 0)) {
+            throw new Win32Exception();
+        }
+    }
+}`
+
+// readToken reads a token from the terminal, without echoing it, or else
+// from stdin, e.g. when piped from a password manager.
+func readToken() (string, error) {
+	if !isInteractive() {
+		in, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading token: %w", err)
+		}
+		return strings.TrimSpace(string(in)), nil
+	}
+	if runtime.GOOS != "windows" {
+		if err := spawn("stty", "-echo"); err == nil {
+			defer func() {
+				_ = spawn("stty", "echo")
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	return prompt("Paste your GitHub personal access token: ")
+}
+
+// runAuthLogin stores a token for the configured GitHub host in the OS
+// keychain.
+func runAuthLogin() error {
+	host, err := githubHost()
+	if err != nil {
+		return err
+	}
+	token, err := readToken()
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return hintedErr{
+			error: errors.New("no token given"),
+			hint:  "for help creating a personal access token, see https://goo.gl/Ep2E6x.",
+		}
+	}
+	if err := keychainStore(host, token); err != nil {
+		return hintedErr{
+			error: fmt.Errorf("storing token in %s: %w", keychainName(), err),
+			hint: `on Linux, backport stores the token with secret-tool, which is usually
+packaged as libsecret-tools or libsecret, and needs a running keyring
+such as GNOME Keyring or KeePassXC. Alternatively, pass the token in the
+BACKPORT_GITHUB_TOKEN environment variable.`,
+		}
+	}
+	infof("Stored your GitHub token for %s in %s.", host, keychainName())
+	if gitConfig("cockroach.githubToken") != "" {
+		infof(`Your Git config still holds a token in plain text, which is no longer
+needed. To remove it, run:
+
+    $ git config --global --unset cockroach.githubToken`)
+	}
+	return nil
+}
+
+// runAuthLogout deletes the token for the configured GitHub host from the OS
+// keychain.
+func runAuthLogout() error {
+	host, err := githubHost()
+	if err != nil {
+		return err
+	}
+	if err := keychainDelete(host); err != nil {
+		return fmt.Errorf("deleting token from %s: %w", keychainName(), err)
+	}
+	infof("Deleted your GitHub token for %s from %s.", host, keychainName())
+	return nil
+}
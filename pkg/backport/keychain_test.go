@@ -0,0 +1,17 @@
+package backport
+
+import "testing"
+
+func TestSecurityQuote(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"github.com", `"github.com"`},
+		{"ghp_abc 123", `"ghp_abc 123"`},
+		{`a"b`, `"a\"b"`},
+		{`a\b`, `"a\\b"`},
+		{"it's", `"it's"`},
+	} {
+		if got := securityQuote(tc.in); got != tc.want {
+			t.Errorf("securityQuote(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultExcludedLabels are the labels never copied to backport PRs, as they
+// only make sense on the source PR.
+var defaultExcludedLabels = []string{"backport-*"}
+
+// copiedLabels returns the labels of the selected PRs that are copied to their
+// backport PR, in order and without duplicates. Labels that match any of the
+// glob patterns in defaultExcludedLabels or in the multi-valued
+// backport.excludeLabel Git config option are left out.
+func (prs pullRequests) copiedLabels() ([]string, error) {
+	excluded := append(append([]string(nil), defaultExcludedLabels...), gitConfigAll("backport.excludeLabel")...)
+	seen := map[string]bool{}
+	var labels []string
+	for _, pr := range prs.selectedPRs() {
+	labelLoop:
+		for _, label := range pr.labels {
+			if seen[label] {
+				continue
+			}
+			seen[label] = true
+			for _, pattern := range excluded {
+				match, err := path.Match(pattern, label)
+				if err != nil {
+					return nil, fmt.Errorf("invalid backport.excludeLabel pattern %q: %w", pattern, err)
+				}
+				if match {
+					continue labelLoop
+				}
+			}
+			labels = append(labels, label)
+		}
+	}
+	return labels, nil
+}
+
+// titlePrefixRE matches the conventional prefix of a PR title or commit
+// subject that names the affected areas, e.g. "sql: " or "kv,storage: ".
+var titlePrefixRE = regexp.MustCompile(`^([[:alnum:]_./\-]+(?:, ?[[:alnum:]_./\-]+)*): `)
+
+// titleAreas returns the areas named by the prefix of title, if any.
+func titleAreas(title string) []string {
+	m := titlePrefixRE.FindStringSubmatch(title)
+	if m == nil {
+		return nil
+	}
+	var areas []string
+	for _, area := range strings.Split(m[1], ",") {
+		areas = append(areas, strings.TrimSpace(area))
+	}
+	return areas
+}
+
+// addAreaLabels adds to labels the labels for the areas named by the title
+// prefixes of the selected PRs, or by the subjects of raw commits, for
+// --label-from-title. The areas are mapped to labels by the multi-valued backport.areaLabel
+// option, whose values are of the form "AREA LABEL", where AREA is a glob
+// pattern like sql or sql/*. An area may map to several labels.
+func (prs pullRequests) addAreaLabels(labels []string) ([]string, error) {
+	type mapping struct{ pattern, label string }
+	var mappings []mapping
+	for _, v := range gitConfigAll("backport.areaLabel") {
+		fields := strings.Fields(v)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed backport.areaLabel %q; expected \"AREA LABEL\"", v)
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("invalid backport.areaLabel pattern %q: %w", fields[0], err)
+		}
+		mappings = append(mappings, mapping{pattern: fields[0], label: fields[1]})
+	}
+	if len(mappings) == 0 {
+		return nil, hintedErr{
+			error: errors.New("--label-from-title requires backport.areaLabel"),
+			hint: `map the areas in PR title prefixes to labels, e.g.:
+
+    $ git config --add backport.areaLabel "sql A-sql-execution"
+    $ git config --add backport.areaLabel "kv* A-kv"`,
+		}
+	}
+
+	var titles []string
+	for _, pr := range prs.selectedPRs() {
+		if pr.isRaw() {
+			for _, sha := range pr.selectedCommits {
+				titles = append(titles, pr.subject(sha))
+			}
+		} else {
+			titles = append(titles, strings.TrimPrefix(pr.title, pr.baseBranch+": "))
+		}
+	}
+	seen := map[string]bool{}
+	for _, label := range labels {
+		seen[label] = true
+	}
+	for _, title := range titles {
+		for _, area := range titleAreas(title) {
+			for _, m := range mappings {
+				if ok, _ := path.Match(m.pattern, area); ok && !seen[m.label] {
+					seen[m.label] = true
+					labels = append(labels, m.label)
+				}
+			}
+		}
+	}
+	return labels, nil
+}
+
+// existingLabels returns the labels that exist in the upstream repository,
+// warning about the others. Adding a missing label to a PR would create it,
+// e.g. from a stale backport.areaLabel mapping, so they are left out. Labels
+// that cannot be looked up for other reasons are kept.
+func existingLabels(ctx context.Context, c config, labels []string) []string {
+	var existing []string
+	for _, label := range labels {
+		_, res, err := c.ghClient.Issues.GetLabel(ctx, c.upstreamOwner, c.upstreamRepo, url.PathEscape(label))
+		if err != nil && res != nil && res.StatusCode == http.StatusNotFound {
+			warnf("label %q does not exist in %s/%s; not adding it", label, c.upstreamOwner, c.upstreamRepo)
+			continue
+		}
+		existing = append(existing, label)
+	}
+	return existing
+}
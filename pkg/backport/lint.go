@@ -0,0 +1,86 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// lintPR runs the linters configured in backport.lint over the title and body
+// of a backport PR and returns an error describing every failure. Each value of
+// backport.lint is one of:
+//
+//	no-todo-title   the title must not contain "TODO"
+//	section:NAME    the body must contain a non-empty "NAME:" line or a
+//	                non-empty "NAME" Markdown section
+//	exec:COMMAND    COMMAND is run with sh -c and passed the title, a blank
+//	                line, and the body on stdin; it fails if it exits non-zero
+func lintPR(title, body string) error {
+	var failures []string
+	for _, linter := range gitConfigAll("backport.lint") {
+		var err error
+		switch {
+		case linter == "no-todo-title":
+			if strings.Contains(title, "TODO") {
+				err = errors.New("title contains TODO")
+			}
+		case strings.HasPrefix(linter, "section:"):
+			err = lintSection(body, strings.TrimPrefix(linter, "section:"))
+		case strings.HasPrefix(linter, "exec:"):
+			err = lintExec(title, body, strings.TrimPrefix(linter, "exec:"))
+		default:
+			err = errors.New("unknown linter")
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", linter, err))
+		}
+	}
+	if len(failures) > 0 {
+		return hintedErr{
+			error: fmt.Errorf("backport PR failed linting:\n    %s", strings.Join(failures, "\n    ")),
+			hint: `fix the PR title or body by running 'backport --continue' again with
+--edit, --title, --body, or --body-file, or skip linting with
+'backport --continue --no-verify'.`,
+		}
+	}
+	return nil
+}
+
+// lintSection checks that body contains a non-empty section with the given
+// name, either as a "Name: text" line or as a Markdown heading followed by
+// some text.
+func lintSection(body, name string) error {
+	lineRE := regexp.MustCompile(`(?mi)^\s*` + regexp.QuoteMeta(name) + `:[ \t]*(\S.*)?$`)
+	for _, m := range lineRE.FindAllStringSubmatch(body, -1) {
+		if m[1] != "" {
+			return nil
+		}
+	}
+	headingRE := regexp.MustCompile(`(?mi)^#+\s*` + regexp.QuoteMeta(name) + `\s*$`)
+	if loc := headingRE.FindStringIndex(body); loc != nil {
+		rest := body[loc[1]:]
+		if next := regexp.MustCompile(`(?m)^#`).FindStringIndex(rest); next != nil {
+			rest = rest[:next[0]]
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil
+		}
+		return fmt.Errorf("section %q is empty", name)
+	}
+	return fmt.Errorf("missing section %q", name)
+}
+
+func lintExec(title, body, command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = strings.NewReader(title + "\n\n" + body)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// GitHub's merge commits: "Merge pull request #123 from user/branch".
+	githubMergeRE = regexp.MustCompile(`^Merge pull request #(\d+)`)
+	// bors-style merge commits: "Merge #123 #456".
+	borsMergeRE = regexp.MustCompile(`^Merge((?:\s+#\d+)+)\s*$`)
+	// Squash merges: "sql: fix foo (#123)".
+	squashMergeRE = regexp.MustCompile(`\(#(\d+)\)\s*$`)
+	prNumberRE    = regexp.MustCompile(`#(\d+)`)
+)
+
+// mergeCommitPRs returns the full SHA of the master commit named by rev, and
+// the numbers of the PRs that it merged, as named by its subject or, failing
+// that, as reported by GitHub.
+func mergeCommitPRs(ctx context.Context, c config, rev string) (string, []int, error) {
+	if err := fetchBranches(c, "master"); err != nil {
+		return "", nil, fmt.Errorf("fetching master: %w", err)
+	}
+	sha, err := capture("git", "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return "", nil, fmt.Errorf("resolving merge commit %q: %w", rev, err)
+	}
+	if _, err := capture("git", "merge-base", "--is-ancestor", sha, "FETCH_HEAD"); err != nil {
+		return "", nil, fmt.Errorf("merge commit %.10s is not on master", sha)
+	}
+	subject, err := capture("git", "log", "-n1", "--format=%s", sha)
+	if err != nil {
+		return "", nil, fmt.Errorf("reading message of commit %s: %w", sha, err)
+	}
+
+	var prNos []int
+	if m := githubMergeRE.FindStringSubmatch(subject); m != nil {
+		prNo, _ := strconv.Atoi(m[1])
+		prNos = append(prNos, prNo)
+	} else if m := borsMergeRE.FindStringSubmatch(subject); m != nil {
+		for _, n := range prNumberRE.FindAllStringSubmatch(m[1], -1) {
+			prNo, _ := strconv.Atoi(n[1])
+			prNos = append(prNos, prNo)
+		}
+	} else if m := squashMergeRE.FindStringSubmatch(subject); m != nil {
+		prNo, _ := strconv.Atoi(m[1])
+		prNos = append(prNos, prNo)
+	} else if prNo, _ := commitPR(ctx, c, sha); prNo != 0 {
+		prNos = append(prNos, prNo)
+	}
+	if len(prNos) == 0 {
+		return "", nil, fmt.Errorf("unable to determine the PR merged by %.10s (%s)", sha, subject)
+	}
+	return sha, prNos, nil
+}
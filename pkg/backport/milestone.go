@@ -0,0 +1,68 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// findMilestone returns the number of the open upstream milestone for the next
+// release from destBranch, or 0 if there is none. The milestone named by
+// backport.<branch>.milestone is used if set. Otherwise, for release-X.Y, the
+// open milestone titled X.Y.Z or vX.Y.Z with the lowest Z is used, falling
+// back to one titled X.Y or vX.Y.
+func findMilestone(ctx context.Context, c config, destBranch string) (int, error) {
+	want := gitConfig("backport." + destBranch + ".milestone")
+	var re *regexp.Regexp
+	if want == "" {
+		m := releaseVersionRE.FindStringSubmatch(destBranch)
+		if m == nil {
+			return 0, nil
+		}
+		re = regexp.MustCompile(`^v?` + regexp.QuoteMeta(m[1]) + `(?:\.(\d+))?$`)
+	}
+
+	opt := &github.MilestoneListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	best, bestPatch := 0, -1
+	for {
+		milestones, res, err := c.ghClient.Issues.ListMilestones(ctx, c.upstreamOwner, c.upstreamRepo, opt)
+		if err != nil {
+			return 0, fmt.Errorf("listing milestones: %w", err)
+		}
+		for _, ms := range milestones {
+			if want != "" {
+				if ms.GetTitle() == want {
+					return ms.GetNumber(), nil
+				}
+				continue
+			}
+			m := re.FindStringSubmatch(ms.GetTitle())
+			if m == nil {
+				continue
+			}
+			// A milestone for the release as a whole ranks after the patch
+			// releases.
+			patch := 1 << 30
+			if m[1] != "" {
+				patch, _ = strconv.Atoi(m[1])
+			}
+			if best == 0 || patch < bestPatch {
+				best, bestPatch = ms.GetNumber(), patch
+			}
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+	if want != "" {
+		return 0, fmt.Errorf("no open milestone named %q, as configured by backport.%s.milestone", want, destBranch)
+	}
+	return best, nil
+}
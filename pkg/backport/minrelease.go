@@ -0,0 +1,69 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseReleaseVersion parses the major and minor version from a release such
+// as "23.1", or a release branch such as "release-23.1".
+func parseReleaseVersion(s string) (major, minor int, ok bool) {
+	m := releaseVersionRE.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(m[1], ".", 2)
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	return major, minor, err1 == nil && err2 == nil
+}
+
+// checkMinRelease guards release branches older than the oldest release that
+// still accepts backports, as configured by backport.minRelease. Backporting to
+// such a branch requires confirming the backport and justifying it at a
+// prompt; the justification is recorded in destBranch and later in the PR
+// body. Branches that do not name a release are not checked.
+func checkMinRelease(destBranch *destinationBranch) error {
+	minRelease := gitConfig("backport.minRelease")
+	if minRelease == "" {
+		return nil
+	}
+	minMajor, minMinor, ok := parseReleaseVersion(minRelease)
+	if !ok {
+		return fmt.Errorf("malformed backport.minRelease %q; expected a release like 23.1", minRelease)
+	}
+	major, minor, ok := parseReleaseVersion(destBranch.branch)
+	if !ok || major > minMajor || (major == minMajor && minor >= minMinor) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s is older than %s, the oldest release that accepts backports",
+		destBranch.branch, minRelease)
+	if !isInteractive() {
+		return hintedErr{
+			error: errors.New(msg),
+			hint: `backports to releases past the end of their support are usually a
+mistake. If this one is not, run backport from a terminal to confirm it and
+record a justification.`,
+		}
+	}
+	warnf("%s.", msg)
+	answer, err := prompt(fmt.Sprintf("Backport to %s anyway? [y/N] ", destBranch.branch))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(strings.ToLower(answer), "y") {
+		return fmt.Errorf("backport to %s cancelled", destBranch.branch)
+	}
+	justification, err := prompt("Why does this change need to go to an unsupported release? ")
+	if err != nil {
+		return err
+	}
+	if justification == "" {
+		return fmt.Errorf("backport to %s cancelled: a justification is required", destBranch.branch)
+	}
+	destBranch.justification = justification
+	return nil
+}
@@ -0,0 +1,75 @@
+package backport
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// windowsToast shows a toast notification with the title and message given as
+// the two format arguments, which must be quoted with psQuote. The toast is
+// attributed to PowerShell, as notifications from apps that are not
+// registered with Windows are dropped.
+const windowsToast = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode(%s)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode(%s)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($xml))`
+
+// appleScriptQuote quotes s as an AppleScript string. AppleScript only knows
+// the escapes for backslashes and quotes, so line breaks and tabs are turned
+// into spaces, and other control characters, e.g. from colored error
+// messages, are dropped.
+func appleScriptQuote(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// psQuote quotes s as a verbatim PowerShell string. PowerShell also accepts
+// typographic single quotes as delimiters, so those are doubled too.
+func psQuote(s string) string {
+	return "'" + strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019").Replace(s) + "'"
+}
+
+// Notify alerts the user that a backport has finished or needs attention. It
+// sends a desktop notification where one is available and always rings the
+// terminal bell, so that it works over SSH too.
+func Notify(err error) {
+	msg := "Backport complete."
+	if err != nil {
+		msg = fmt.Sprintf("Backport stopped: %s", err)
+	}
+	fmt.Fprint(os.Stderr, "\a")
+	if cmd := notifyCmd("backport", msg); cmd != nil {
+		if _, err := capture(cmd...); err != nil {
+			warnf("unable to send desktop notification: %s", err)
+		}
+	}
+}
+
+func notifyCmd(title, msg string) []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/usr/bin/osascript", "-e", fmt.Sprintf("display notification %s with title %s",
+			appleScriptQuote(msg), appleScriptQuote(title))}
+	case "windows":
+		// Toasts need the WinRT support of Windows PowerShell, which
+		// PowerShell 7 lacks.
+		return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+			fmt.Sprintf(windowsToast, psQuote(title), psQuote(msg))}
+	default:
+		return []string{"notify-send", title, msg}
+	}
+}
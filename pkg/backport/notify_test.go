@@ -0,0 +1,32 @@
+package backport
+
+import "testing"
+
+func TestAppleScriptQuote(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Backport complete.", `"Backport complete."`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\path`, `"C:\\path"`},
+		{"\x1b[31mfailed\x1b[0m", `"[31mfailed[0m"`},
+		{"line\nbreak", `"line break"`},
+		{"café", `"café"`},
+	} {
+		if got := appleScriptQuote(tc.in); got != tc.want {
+			t.Errorf("appleScriptQuote(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPSQuote(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"Backport complete.", "'Backport complete.'"},
+		{"", "''"},
+		{"can't push", "'can''t push'"},
+		{"‘quoted’", "'‘‘quoted’’'"},
+		{"$(Remove-Item x) `n", "'$(Remove-Item x) `n'"},
+	} {
+		if got := psQuote(tc.in); got != tc.want {
+			t.Errorf("psQuote(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
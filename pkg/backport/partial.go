@@ -0,0 +1,65 @@
+package backport
+
+import (
+	"regexp"
+	"strings"
+)
+
+// promisorRemotes returns the promisor remotes of a partial clone, i.e., the
+// remotes that Git lazily fetches missing objects from, along with the object
+// filter of each, e.g. blob:none. It returns nothing for full clones.
+func promisorRemotes() map[string]string {
+	remotes := map[string]string{}
+	// Clones made by Git before 2.24 only record the remote here.
+	if remote := gitConfig("extensions.partialClone"); remote != "" {
+		remotes[remote] = gitConfig("remote." + remote + ".partialCloneFilter")
+	}
+	out, _ := capture("git", "config", "--bool", "--get-regexp", `^remote\..+\.promisor$`)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[1] != "true" {
+			continue
+		}
+		remote := strings.TrimSuffix(strings.TrimPrefix(fields[0], "remote."), ".promisor")
+		remotes[remote] = gitConfig("remote." + remote + ".partialCloneFilter")
+	}
+	return remotes
+}
+
+// findUpstreamPromisor returns the promisor remote that fetches from the
+// upstream repository, if the checkout is a partial clone with one.
+//
+// backport fetches from upstream by URL, which ignores the object filter of
+// the partial clone, so that every object of the fetched history would be
+// downloaded in full; in a blobless clone of a big repository, that runs to
+// gigabytes. Fetching through the promisor remote instead applies the filter,
+// leaving Git to fetch the objects that are actually needed on demand. If no
+// promisor remote fetches from upstream, a warning explains how to set one
+// up.
+func findUpstreamPromisor(c config) string {
+	remotes := promisorRemotes()
+	if len(remotes) == 0 {
+		return ""
+	}
+	upstreamRE := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(c.githubHost) + `[:/]` +
+		regexp.QuoteMeta(c.upstreamOwner+"/"+c.upstreamRepo) + `(?:\.git)?/?$`)
+	var filter string
+	for remote, f := range remotes {
+		url, err := capture("git", "remote", "get-url", remote)
+		if err == nil && upstreamRE.MatchString(url) {
+			return remote
+		}
+		filter = f
+	}
+	if filter == "" {
+		filter = "blob:none"
+	}
+	warnf(`this is a partial clone, but none of its promisor remotes fetches from
+%s/%s, so fetches from there download objects in full. To avoid that,
+make a remote for upstream a promisor remote, e.g., if it is named
+upstream:
+
+    $ git config remote.upstream.promisor true
+    $ git config remote.upstream.partialCloneFilter %s`, c.upstreamOwner, c.upstreamRepo, filter)
+	return ""
+}
@@ -0,0 +1,78 @@
+package backport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// warnMissingPaths warns about files that the commits modify or delete but
+// that do not exist on destBranch, which must have just been fetched into
+// FETCH_HEAD. Cherry-picking such commits fails with a cryptic modify/delete
+// conflict, so the warning explains where the file went: usually it was
+// renamed on master, or added there after the release branch was cut.
+func warnMissingPaths(destBranch string, commits []string) error {
+	added := map[string]bool{}
+	warned := map[string]bool{}
+	for _, sha := range commits {
+		out, err := capture("git", "diff-tree", "--no-commit-id", "-r", "--no-renames",
+			"--name-status", sha)
+		if err != nil {
+			return fmt.Errorf("listing files changed by %.10s: %w", sha, err)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.SplitN(line, "\t", 2)
+			if len(fields) != 2 {
+				continue
+			}
+			status, path := fields[0], fields[1]
+			if status == "A" {
+				// Later commits may touch files added by earlier ones.
+				added[path] = true
+				continue
+			}
+			if added[path] || warned[path] {
+				continue
+			}
+			if _, err := capture("git", "cat-file", "-e", "FETCH_HEAD:"+path); err == nil {
+				continue
+			}
+			warned[path] = true
+			explanation, err := explainMissingPath(sha, path)
+			if err != nil {
+				return err
+			}
+			warnf("%s, which %.10s changes, does not exist on %s; %s",
+				path, sha, destBranch, explanation)
+		}
+	}
+	return nil
+}
+
+// explainMissingPath describes what happened to path between the point where
+// sha's history diverged from FETCH_HEAD and sha.
+func explainMissingPath(sha, path string) (string, error) {
+	base, err := capture("git", "merge-base", "FETCH_HEAD", sha)
+	if err != nil {
+		return "", fmt.Errorf("finding merge base of %.10s: %w", sha, err)
+	}
+	out, err := capture("git", "log", "-M", "--follow", "--diff-filter=RA", "--name-status",
+		"--format=%h (\"%s\")", base+".."+sha+"^", "--", path)
+	if err != nil {
+		return "", fmt.Errorf("tracing history of %s: %w", path, err)
+	}
+	// The log lists the most recent change first: a commit line followed by
+	// its status line, e.g. "R090\told\tnew" or "A\tpath".
+	var commit string
+	for _, line := range strings.Split(out, "\n") {
+		status := strings.Split(line, "\t")
+		switch {
+		case len(status) == 1 && line != "":
+			commit = line
+		case len(status) == 3 && strings.HasPrefix(status[0], "R"):
+			return fmt.Sprintf("it was renamed from %s by %s", status[1], commit), nil
+		case len(status) == 2 && status[0] == "A":
+			return fmt.Sprintf("it was added by %s, which is missing from the release", commit), nil
+		}
+	}
+	return "it may have been moved or deleted on the release branch", nil
+}
@@ -0,0 +1,106 @@
+package backport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pickCommits lets the user toggle which of the PRs' commits to backport,
+// starting from the current selection, and lists the files each one touches.
+func (prs pullRequests) pickCommits() error {
+	type entry struct {
+		pr    *pullRequest
+		sha   string
+		files string
+	}
+	var entries []entry
+	selected := map[string]bool{}
+	for i := range prs {
+		pr := &prs[i]
+		for _, sha := range pr.selectedCommits {
+			selected[sha] = true
+		}
+		for _, sha := range pr.commits {
+			// Commits of unmerged PRs may not be available locally, in which
+			// case their files go unlisted.
+			files, _ := capture("git", "show", "--no-renames", "--name-only", "--format=", sha)
+			entries = append(entries, entry{pr: pr, sha: sha, files: files})
+		}
+	}
+
+	for {
+		var list strings.Builder
+		for i, e := range entries {
+			mark := " "
+			if selected[e.sha] {
+				mark = "x"
+			}
+			fmt.Fprintf(&list, "  [%s] %d) %.10s  %s  %s\n", mark, i+1, e.sha, e.pr.ref(), e.pr.subject(e.sha))
+			for _, file := range strings.Fields(e.files) {
+				fmt.Fprintf(&list, "              %s\n", file)
+			}
+		}
+		renderer.Prompt(list.String())
+		answer, err := prompt("Toggle commits by number (e.g. 1 3-4), [a]ll, [n]one, or press enter to continue: ")
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			var any bool
+			for i := range prs {
+				pr := &prs[i]
+				pr.selectedCommits = nil
+				for _, sha := range pr.commits {
+					if selected[sha] {
+						pr.selectedCommits = append(pr.selectedCommits, sha)
+						any = true
+					}
+				}
+			}
+			if !any {
+				return errors.New("no commits selected")
+			}
+			return nil
+		case "a", "all":
+			for _, e := range entries {
+				selected[e.sha] = true
+			}
+		case "n", "none":
+			selected = map[string]bool{}
+		default:
+			toggle, err := parseChoices(answer, len(entries))
+			if err != nil {
+				warnf("%s", err)
+				continue
+			}
+			for _, n := range toggle {
+				sha := entries[n-1].sha
+				selected[sha] = !selected[sha]
+			}
+		}
+	}
+}
+
+// parseChoices parses a list of numbers and ranges such as "1 3-4" or "1,3-4",
+// each between 1 and max.
+func parseChoices(s string, max int) ([]int, error) {
+	var choices []int
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		lo, hi := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			lo, hi = field[:i], field[i+1:]
+		}
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || from < 1 || to > max || from > to {
+			return nil, fmt.Errorf("invalid choice %q; expected numbers from 1 to %d", field, max)
+		}
+		for n := from; n <= to; n++ {
+			choices = append(choices, n)
+		}
+	}
+	return choices, nil
+}
@@ -0,0 +1,197 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// prefetchRefPrefix is where 'backport prefetch' keeps its copies of the
+	// upstream branches.
+	prefetchRefPrefix = "refs/backport/prefetch/"
+	// defaultPrefetchMaxAge is how long prefetched branches are used instead
+	// of fetching, unless overridden by backport.prefetchMaxAge.
+	defaultPrefetchMaxAge = 15 * time.Minute
+	// prefetchReleaseCount is how many of the newest release branches are
+	// prefetched when backport.minRelease does not say which are supported.
+	prefetchReleaseCount = 4
+)
+
+func (c config) prefetchFile() string {
+	return filepath.Join(c.gitDir, "BACKPORT_PREFETCH")
+}
+
+// fetchUpstream fetches the named upstream branches into FETCH_HEAD, in order,
+// no deeper than --depth and with the object filter of --filter, if given.
+func fetchUpstream(c config, branches ...string) error {
+	args := []string{"git", "fetch"}
+	if c.fetchDepth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", c.fetchDepth))
+	}
+	filterArgs, err := c.filterArgs()
+	if err != nil {
+		return err
+	}
+	args = append(append(args, filterArgs...), c.upstreamURL())
+	for _, branch := range branches {
+		args = append(args, "refs/heads/"+branch)
+	}
+	if err := spawn(args...); err != nil {
+		return fetchErr{err}
+	}
+	return nil
+}
+
+// fetchBranches is like fetchUpstream, but if 'backport prefetch' fetched all
+// of the branches recently, they are fetched from its local copies instead,
+// which skips the network altogether.
+func fetchBranches(c config, branches ...string) error {
+	if !prefetchFresh(c) {
+		return fetchUpstream(c, branches...)
+	}
+	args := []string{"git", "fetch", "--quiet", "."}
+	for _, branch := range branches {
+		ref := prefetchRefPrefix + branch
+		if _, err := capture("git", "rev-parse", "--verify", "--quiet", ref); err != nil {
+			return fetchUpstream(c, branches...)
+		}
+		args = append(args, ref)
+	}
+	if err := spawn(args...); err != nil {
+		return fetchErr{err}
+	}
+	return nil
+}
+
+// prefetchFresh returns whether the last prefetch is recent enough to be used.
+func prefetchFresh(c config) bool {
+	in, err := ioutil.ReadFile(c.prefetchFile())
+	if err != nil {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(in)))
+	if err != nil {
+		return false
+	}
+	maxAge := defaultPrefetchMaxAge
+	if s := gitConfig("backport.prefetchMaxAge"); s != "" {
+		if maxAge, err = time.ParseDuration(s); err != nil {
+			warnf("ignoring malformed backport.prefetchMaxAge %q", s)
+			maxAge = defaultPrefetchMaxAge
+		}
+	}
+	return time.Since(t) < maxAge
+}
+
+// prefetched returns whether the prefetched copies of the PRs' base branches
+// contain their merge commits. PRs that merged since the last prefetch
+// require an actual fetch.
+func (prs pullRequests) prefetched() bool {
+	for _, pr := range prs {
+		if pr.mergeCommit == "" {
+			continue
+		}
+		_, err := capture("git", "merge-base", "--is-ancestor", pr.mergeCommit, prefetchRefPrefix+pr.baseBranch)
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// prefetchBranches returns the upstream branches to prefetch: master and the
+// supported release branches, i.e., those no older than backport.minRelease,
+// or the newest few if it is not set.
+func prefetchBranches(ctx context.Context, c config) ([]string, error) {
+	releaseBranches, err := listReleaseBranches(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	branches := supportedReleaseBranches(seriesBranches(releaseBranches), gitConfig("backport.minRelease"))
+	return append([]string{"master"}, branches...), nil
+}
+
+// supportedReleaseBranches returns the release branches, newest first, that are
+// no older than minRelease, or the newest few if it is empty. The branches
+// must be sorted by version.
+func supportedReleaseBranches(releaseBranches []string, minRelease string) []string {
+	minMajor, minMinor, haveMin := parseReleaseVersion(minRelease)
+	var branches []string
+	for i := len(releaseBranches) - 1; i >= 0; i-- {
+		branch := releaseBranches[i]
+		if haveMin {
+			major, minor, ok := parseReleaseVersion(branch)
+			if ok && (major < minMajor || (major == minMajor && minor < minMinor)) {
+				continue
+			}
+		} else if len(branches) == prefetchReleaseCount {
+			break
+		}
+		branches = append(branches, branch)
+	}
+	return branches
+}
+
+// prefetch fetches the branches returned by prefetchBranches into local refs
+// under prefetchRefPrefix, drops the copies of other branches, and records
+// the time of the prefetch.
+func prefetch(ctx context.Context, c config) error {
+	branches, err := prefetchBranches(ctx, c)
+	if err != nil {
+		return err
+	}
+	args := []string{"git", "fetch", "--quiet", c.upstreamURL()}
+	keep := map[string]bool{}
+	for _, branch := range branches {
+		args = append(args, fmt.Sprintf("+refs/heads/%s:%s%[1]s", branch, prefetchRefPrefix))
+		keep[prefetchRefPrefix+branch] = true
+	}
+	now := time.Now()
+	if err := spawn(args...); err != nil {
+		return fmt.Errorf("prefetching %s: %w", strings.Join(branches, ", "), err)
+	}
+	out, err := capture("git", "for-each-ref", "--format=%(refname)", prefetchRefPrefix)
+	if err != nil {
+		return fmt.Errorf("listing prefetched branches: %w", err)
+	}
+	for _, ref := range strings.Fields(out) {
+		if !keep[ref] {
+			if err := spawn("git", "update-ref", "-d", ref); err != nil {
+				return fmt.Errorf("deleting %s: %w", ref, err)
+			}
+		}
+	}
+	err = ioutil.WriteFile(c.prefetchFile(), []byte(now.UTC().Format(time.RFC3339)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("writing prefetch file: %w", err)
+	}
+	infof("Prefetched %s.", strings.Join(branches, ", "))
+	return nil
+}
+
+// runPrefetch prefetches once or, given an interval, keeps prefetching until
+// it is killed or the context is done. Failures in the latter mode, e.g. while
+// offline, are reported and retried at the next interval.
+func runPrefetch(ctx context.Context, interval time.Duration) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return prefetch(ctx, c)
+	}
+	for {
+		if err := prefetch(ctx, c); err != nil {
+			warnf("%s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package backport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSupportedReleaseBranches(t *testing.T) {
+	releaseBranches := []string{
+		"release-22.1", "release-22.2", "release-23.1", "release-23.2", "release-24.1", "release-24.2",
+	}
+	for _, tc := range []struct {
+		minRelease string
+		want       []string
+	}{
+		{"", []string{"release-24.2", "release-24.1", "release-23.2", "release-23.1"}},
+		{"23.2", []string{"release-24.2", "release-24.1", "release-23.2"}},
+		{"22.1", []string{"release-24.2", "release-24.1", "release-23.2", "release-23.1", "release-22.2", "release-22.1"}},
+		{"25.1", nil},
+	} {
+		if got := supportedReleaseBranches(releaseBranches, tc.minRelease); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("supportedReleaseBranches(%q) = %q, want %q", tc.minRelease, got, tc.want)
+		}
+	}
+	if got := supportedReleaseBranches(releaseBranches[:2], ""); !reflect.DeepEqual(got, []string{"release-22.2", "release-22.1"}) {
+		t.Errorf("supportedReleaseBranches of two branches = %q", got)
+	}
+}
@@ -0,0 +1,121 @@
+package backport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// skipPresentCommits drops the commits of p that already exist on its
+// destination branch, with a notice for each, so that cherry-picking them does
+// not fail as empty, e.g. when part of a PR was backported before. A commit
+// exists on the branch if a commit there makes the same change, as determined
+// by git patch-id, or records it in a "(cherry picked from commit ...)" line.
+// The squashes in p.Squash are adjusted to match, and if every commit is
+// present, p.Commits is left empty. Stacked backports are left alone, as the
+// backport they are stacked on was checked already.
+func (p *pendingBackport) skipPresentCommits(c config) error {
+	if p.StackOn != "" || len(p.Commits) == 0 {
+		return nil
+	}
+	err := fetchBranches(c, p.DestBranch)
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", p.DestBranch, err)
+	}
+	base, err := capture("git", "merge-base", "FETCH_HEAD", p.Commits[len(p.Commits)-1])
+	if err != nil {
+		return fmt.Errorf("finding merge base with %s: %w", p.DestBranch, err)
+	}
+
+	// Only the commits on the branch that touch the same files can make the
+	// same change.
+	seen := map[string]bool{}
+	var paths []string
+	for _, sha := range p.Commits {
+		out, err := capture("git", "diff-tree", "--no-commit-id", "-r", "--name-only", sha)
+		if err != nil {
+			return fmt.Errorf("listing files changed by %.10s: %w", sha, err)
+		}
+		for _, path := range strings.Split(out, "\n") {
+			if path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	out, err := capture(append([]string{"git", "log", "--format=%B", base + "..FETCH_HEAD", "--"}, paths...)...)
+	if err != nil {
+		return fmt.Errorf("listing commits on %s: %w", p.DestBranch, err)
+	}
+	cherryPicked := map[string]bool{}
+	for _, m := range cherryPickedRE.FindAllStringSubmatch(out, -1) {
+		cherryPicked[m[1]] = true
+	}
+	onBranch, err := patchIDs(append([]string{"--no-merges", "--full-diff", base + "..FETCH_HEAD", "--"}, paths...)...)
+	if err != nil {
+		return fmt.Errorf("computing patch IDs of commits on %s: %w", p.DestBranch, err)
+	}
+	picked, err := patchIDs(append([]string{"--no-walk=unsorted"}, p.Commits...)...)
+	if err != nil {
+		return fmt.Errorf("computing patch IDs of backported commits: %w", err)
+	}
+	samePatch := map[string]bool{}
+	for _, id := range onBranch {
+		samePatch[id] = true
+	}
+
+	var kept []string
+	squash := append([]squashedPR(nil), p.Squash...)
+	group, end := 0, 0
+	if len(squash) > 0 {
+		end = squash[0].Count
+	}
+	for i, sha := range p.Commits {
+		for len(squash) > 0 && i >= end {
+			group++
+			end += squash[group].Count
+		}
+		if !cherryPicked[sha] && !samePatch[picked[sha]] {
+			kept = append(kept, sha)
+			continue
+		}
+		subject, _ := capture("git", "log", "-n1", "--format=%s", sha)
+		infof("Note: skipping %.10s (%s), which is already on %s.", sha, subject, p.DestBranch)
+		if len(squash) > 0 {
+			squash[group].Count--
+		}
+	}
+	p.Commits = kept
+	if len(squash) > 0 {
+		p.Squash = nil
+		for _, s := range squash {
+			if s.Count > 0 {
+				p.Squash = append(p.Squash, s)
+			}
+		}
+	}
+	return nil
+}
+
+// patchIDs runs git log with the given arguments and returns the stable patch
+// ID of each commit that it lists, keyed by commit SHA.
+func patchIDs(logArgs ...string) (map[string]string, error) {
+	patches, err := capture(append([]string{"git", "log", "-p", "--format=commit %H"}, logArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := captureWithInput(patches, "git", "patch-id", "--stable")
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			ids[fields[1]] = fields[0]
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,41 @@
+package backport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// batch disables prompting, e.g. while scanning for PRs to backport.
+var batch bool
+
+// isInteractive reports whether stdin is attached to a terminal, i.e., whether
+// it is reasonable to prompt the user for input.
+func isInteractive() bool {
+	if batch {
+		return false
+	}
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// prompt prints question to stderr and returns the line of input the user
+// types in response, with surrounding whitespace removed.
+func prompt(question string) (string, error) {
+	if !isInteractive() {
+		return "", errors.New("cannot prompt for input: stdin is not a terminal")
+	}
+	renderer.Prompt(question)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
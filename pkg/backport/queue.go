@@ -0,0 +1,211 @@
+package backport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// pendingBackport is a backport to a single destination branch. The
+// in-progress backport and the backports that have yet to run, e.g., when
+// backporting to several releases at once, are persisted in the queue file so
+// that 'backport --continue' can pick them up after a conflict.
+type pendingBackport struct {
+	DestBranch     string   `json:"dest_branch"`
+	BackportBranch string   `json:"backport_branch"`
+	URL            string   `json:"url"`
+	Commits        []string `json:"commits"`
+	CreatePR       bool     `json:"create_pr,omitempty"`
+	Draft          bool     `json:"draft,omitempty"`
+	AutoResolve    string   `json:"auto_resolve,omitempty"`
+	IgnoreSpace    bool     `json:"ignore_space,omitempty"`
+	RecordOrigin   bool     `json:"record_origin,omitempty"`
+	Labels         []string `json:"labels,omitempty"`    // copied from the source PRs
+	Reviewers      []string `json:"reviewers,omitempty"` // the source PRs' authors and approvers
+	Remote         string   `json:"remote,omitempty"`    // the --remote to push to
+	Edit           bool     `json:"edit,omitempty"`      // whether to edit the title and body before pushing
+	Bundle         string   `json:"bundle,omitempty"`    // where to write a conflict bundle
+	Trailers       []string `json:"trailers,omitempty"`  // appended to every backported commit
+	Committer      string   `json:"committer,omitempty"` // "NAME <EMAIL>" to commit as
+	Depth          int      `json:"depth,omitempty"`     // the --depth to fetch with
+	Filter         string   `json:"filter,omitempty"`    // the --filter to fetch with
+
+	// Squash, if set, collapses the cherry-picked commits of each PR into
+	// one commit before the backport branch is pushed.
+	Squash   []squashedPR `json:"squash,omitempty"`
+	Worktree string       `json:"worktree,omitempty"` // path of the worktree in --worktree mode
+	Origin   string       `json:"origin,omitempty"`   // the worktree to return to from Worktree
+
+	// CloseSuperseded closes the open backport PRs replaced by this one.
+	CloseSuperseded bool `json:"close_superseded,omitempty"`
+
+	// SourcePRs are the PRs being backported, which are commented on with a
+	// link to the backport PR unless NoComment is set.
+	SourcePRs []int `json:"source_prs,omitempty"`
+	NoComment bool  `json:"no_comment,omitempty"`
+
+	// StackOn, if set, names the backport branch of the previous backport in a
+	// cascade, to StackBase, whose commits are cherry-picked instead of
+	// Commits so that its conflict resolution is reused.
+	StackOn   string `json:"stack_on,omitempty"`
+	StackBase string `json:"stack_base,omitempty"`
+}
+
+func (c config) queueFile() string {
+	return filepath.Join(c.gitDir, "BACKPORT_QUEUE")
+}
+
+// saveQueue persists the pending backports, removing the queue file if there
+// are none.
+func saveQueue(c config, pending []pendingBackport) error {
+	if len(pending) == 0 {
+		err := os.Remove(c.queueFile())
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing queue file: %w", err)
+		}
+		return nil
+	}
+	out, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding queue file: %w", err)
+	}
+	if err := ioutil.WriteFile(c.queueFile(), out, 0644); err != nil {
+		return fmt.Errorf("writing queue file: %w", err)
+	}
+	return nil
+}
+
+// loadQueue returns the pending backports saved by saveQueue, if any.
+func loadQueue(c config) ([]pendingBackport, error) {
+	in, err := ioutil.ReadFile(c.queueFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading queue file: %w", err)
+	}
+	var pending []pendingBackport
+	if err := json.Unmarshal(in, &pending); err != nil {
+		return nil, fmt.Errorf("malformatted queue file: %w", err)
+	}
+	return pending, nil
+}
+
+// runPending runs each of the pending backports in turn. The queue file
+// tracks the in-progress backport and the ones after it, so that if one of
+// them fails, e.g., because it requires manual conflict resolution, 'backport
+// --continue' can pick up where it left off.
+func runPending(ctx context.Context, c config, pending []pendingBackport) error {
+	summary.c = &c
+	for i := range pending {
+		if err := pending[i].skipPresentCommits(c); err != nil {
+			return err
+		}
+		if len(pending[i].Commits) == 0 && pending[i].StackOn == "" {
+			infof("Nothing to backport to %s: all of the commits are already there.", pending[i].DestBranch)
+			for j := range pending[i+1:] {
+				if next := &pending[i+1+j]; next.StackOn == pending[i].BackportBranch {
+					// Cherry-pick from master instead.
+					next.StackOn, next.StackBase = "", ""
+				}
+			}
+			continue
+		}
+		if err := saveQueue(c, pending[i:]); err != nil {
+			return err
+		}
+		p := pending[i]
+		err := startBackport(c, p)
+		if err == nil {
+			err = finalize(ctx, c, p)
+		}
+		if err != nil {
+			if e := (hintedErr{}); i+1 < len(pending) && errors.As(err, &e) {
+				e.hint += fmt.Sprintf("\n\n%d more backport(s) are queued and will start after the\ncurrent one is finished with 'backport --continue'.", len(pending)-i-1)
+				return e
+			}
+			return err
+		}
+	}
+	return saveQueue(c, nil)
+}
+
+// startBackport creates the backport branch for p and cherry-picks its
+// commits, which must already have been fetched.
+func startBackport(c config, p pendingBackport) error {
+	commits := p.Commits
+	if p.StackOn != "" {
+		var err error
+		commits, err = stackedCommits(c, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := useCommitter(p); err != nil {
+		return err
+	}
+	err := fetchBranches(c, p.DestBranch)
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", p.DestBranch, err)
+	}
+	if err := warnMissingPaths(p.DestBranch, commits); err != nil {
+		return err
+	}
+
+	if p.Worktree != "" {
+		err = addWorktree(p)
+	} else {
+		err = spawn("git", "checkout", whenForced("--force", "--no-force"),
+			whenForced("-B", "-b"), p.BackportBranch, "FETCH_HEAD")
+	}
+	if err != nil {
+		return fmt.Errorf("creating backport branch %q: %w", p.BackportBranch, err)
+	}
+	base, err := capture("git", "rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("looking up %q branch: %w", p.DestBranch, err)
+	}
+
+	err = ioutil.WriteFile(c.urlFile(), []byte(p.URL), 0644)
+	if err != nil {
+		return fmt.Errorf("writing url file: %w", err)
+	}
+
+	var cherryPickArgs []string
+	if p.IgnoreSpace {
+		cherryPickArgs = append(cherryPickArgs, "-Xignore-all-space")
+	}
+	if p.RecordOrigin {
+		cherryPickArgs = append(cherryPickArgs, "-x")
+	}
+	if p.AutoResolve == "trivial" {
+		err = cherryPickLeniently(commits, cherryPickArgs)
+	} else {
+		args := append([]string{"git", "cherry-pick"}, cherryPickArgs...)
+		err = spawn(append(args, commits...)...)
+	}
+	if err != nil {
+		if err := recordConflict(c); err != nil {
+			return err
+		}
+		hint := `Automatic cherry-picking failed. This usually indicates that manual
+conflict resolution is required. Run 'backport --continue' to resume
+backporting. To give up instead, run 'backport --abort'.`
+		if p.Bundle != "" {
+			if err := writeConflictBundle(c, p, base, commits); err != nil {
+				warnf("unable to write conflict bundle: %s", err)
+			} else {
+				hint += fmt.Sprintf("\n\nTo hand the backport off, send %s to a teammate, who can\ntake it over with 'backport adopt --from-bundle %[1]s'.", p.Bundle)
+			}
+		}
+		if p.Worktree != "" {
+			hint += fmt.Sprintf("\n\nThe backport is checked out in a separate worktree:\n\n    $ cd %s", p.Worktree)
+		}
+		return hintedErr{error: err, hint: hint}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package backport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rawCommits returns a pseudo-PR, numbered 0, holding the commits given with
+// --sha, for changes that landed without a PR or that are backported ahead
+// of their PR. Commits that are missing locally are fetched from upstream,
+// which requires their full SHA.
+func rawCommits(c config, shas []string) (pullRequest, error) {
+	pr := pullRequest{
+		baseBranch: "master",
+		messages:   map[string]string{},
+	}
+	seen := map[string]bool{}
+	var bodies []string
+	for _, ref := range shas {
+		sha, err := capture("git", "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+		if err != nil {
+			if err := spawn("git", "fetch", c.upstreamURL(), ref); err != nil {
+				return pullRequest{}, hintedErr{
+					error: fmt.Errorf("unknown commit %q", ref),
+					hint: `give the full SHA of commits that are only on GitHub, so that they can
+be fetched, or fetch them yourself first.`,
+				}
+			}
+			if sha, err = capture("git", "rev-parse", "--verify", "FETCH_HEAD^{commit}"); err != nil {
+				return pullRequest{}, fmt.Errorf("resolving commit %q: %w", ref, err)
+			}
+		}
+		if seen[sha] {
+			continue
+		}
+		seen[sha] = true
+		msg, err := capture("git", "log", "-n1", "--format=%B", sha)
+		if err != nil {
+			return pullRequest{}, fmt.Errorf("reading message of commit %s: %w", sha, err)
+		}
+		pr.commits = append(pr.commits, sha)
+		pr.selectedCommits = append(pr.selectedCommits, sha)
+		pr.messages[sha] = msg
+		bodies = append(bodies, msg)
+	}
+	// The commit messages stand in for the PR body, so that they end up in
+	// the backport PR and its references are found.
+	pr.body = strings.Join(bodies, "\n\n")
+	return pr, nil
+}
+
+// ref refers to pr in listings of commits.
+func (pr pullRequest) ref() string {
+	if pr.isRaw() {
+		return "--sha"
+	}
+	return fmt.Sprintf("#%d", pr.number)
+}
+
+// untitled returns whether title cannot name the backport of prs, as is the
+// case for several PRs or several raw commits.
+func (prs pullRequests) untitled() bool {
+	prs = prs.selectedPRs()
+	return len(prs) > 1 || (len(prs) == 1 && prs[0].isRaw() && len(prs[0].selectedCommits) > 1)
+}
+
+// isRaw returns whether pr holds commits given with --sha rather than an
+// actual PR.
+func (pr pullRequest) isRaw() bool {
+	return pr.number == 0
+}
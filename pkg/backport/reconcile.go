@@ -0,0 +1,160 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// runReconcile cross-checks the backport-X.Y.x labels on upstream PRs against
+// the backport PRs that have actually merged into the corresponding release
+// branch. It reports labeled PRs that were never backported, as well as
+// backports whose source PR never carried the label.
+func runReconcile(ctx context.Context, releaseArg string) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	releaseBranch, err := resolveRelease(ctx, c, releaseArg)
+	if err != nil {
+		return err
+	}
+	label := backportLabel(strings.TrimPrefix(releaseBranch, "release-"))
+
+	labeled, err := searchPullRequests(ctx, c, fmt.Sprintf("is:merged label:%q", label))
+	if err != nil {
+		return err
+	}
+	backports, err := searchPullRequests(ctx, c, fmt.Sprintf("is:merged base:%s", releaseBranch))
+	if err != nil {
+		return err
+	}
+
+	// Map each source PR to the merged backport PRs that reference it.
+	backportedVia := map[int][]int{}
+	for _, bp := range backports {
+		for _, src := range backportSources(bp.GetBody()) {
+			backportedVia[src] = append(backportedVia[src], bp.GetNumber())
+		}
+	}
+
+	isLabeled := map[int]bool{}
+	var missing []github.Issue
+	for _, pr := range labeled {
+		isLabeled[pr.GetNumber()] = true
+		if len(backportedVia[pr.GetNumber()]) == 0 {
+			missing = append(missing, pr)
+		}
+	}
+
+	var unlabeled []int
+	for src := range backportedVia {
+		if !isLabeled[src] {
+			unlabeled = append(unlabeled, src)
+		}
+	}
+	sort.Ints(unlabeled)
+
+	if len(missing) > 0 {
+		infof("Labeled %s but not backported to %s:", label, releaseBranch)
+		for _, pr := range missing {
+			infof("    #%d  %s", pr.GetNumber(), pr.GetTitle())
+		}
+	}
+	if len(unlabeled) > 0 {
+		if len(missing) > 0 {
+			renderer.Info("")
+		}
+		infof("Backported to %s but not labeled %s:", releaseBranch, label)
+		for _, src := range unlabeled {
+			infof("    #%d  (via %s)", src, formatPRNumbers(backportedVia[src]))
+		}
+	}
+
+	if n := len(missing) + len(unlabeled); n > 0 {
+		return fmt.Errorf("found %d discrepancies between %s and %s", n, label, releaseBranch)
+	}
+	infof("%s and %s agree", label, releaseBranch)
+	return nil
+}
+
+const (
+	// searchResultLimit is the most results that the GitHub search API
+	// returns for a query, however many match it.
+	searchResultLimit = 1000
+	// minSearchWindow is the shortest creation period that searches are
+	// split into to stay under searchResultLimit.
+	minSearchWindow = time.Hour
+)
+
+// searchEpoch predates every PR on GitHub.
+var searchEpoch = time.Date(2008, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// searchPullRequests returns all upstream PRs matching the given GitHub search
+// query. Queries matching more PRs than the search API returns are split by
+// the creation time of the PRs.
+func searchPullRequests(ctx context.Context, c config, query string) ([]github.Issue, error) {
+	return searchPullRequestsCreated(ctx, c, query, time.Time{}, time.Time{})
+}
+
+// searchPullRequestsCreated is like searchPullRequests, but only returns the
+// PRs created between from and to, inclusive, unless both are zero.
+func searchPullRequestsCreated(
+	ctx context.Context, c config, query string, from, to time.Time,
+) ([]github.Issue, error) {
+	full := fmt.Sprintf("repo:%s/%s is:pr %s", c.upstreamOwner, c.upstreamRepo, query)
+	if !from.IsZero() {
+		full += fmt.Sprintf(" created:%s..%s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	opt := &github.SearchOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var all []github.Issue
+	for {
+		res, resp, err := c.ghClient.Search.Issues(ctx, full, opt)
+		if err != nil {
+			return nil, fmt.Errorf("searching pull requests (%s): %w", full, err)
+		}
+		if total := res.GetTotal(); total > searchResultLimit && opt.Page == 0 {
+			if from.IsZero() {
+				from, to = searchEpoch, time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+			}
+			if to.Sub(from) > minSearchWindow {
+				mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+				older, err := searchPullRequestsCreated(ctx, c, query, from, mid)
+				if err != nil {
+					return nil, err
+				}
+				newer, err := searchPullRequestsCreated(ctx, c, query, mid.Add(time.Second), to)
+				if err != nil {
+					return nil, err
+				}
+				return append(older, newer...), nil
+			}
+			warnf("%d pull requests match %q, of which only the first %d are considered",
+				total, full, searchResultLimit)
+		}
+		all = append(all, res.Issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+func formatPRNumbers(prNos []int) string {
+	var s string
+	for i, prNo := range prNos {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("#%d", prNo)
+	}
+	return s
+}
@@ -0,0 +1,116 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var releaseTagRE = regexp.MustCompile(`refs/tags/(v(\d+)\.(\d+)\.(\d+)(-\S+)?)$`)
+
+// latestTags returns the newest vX.Y.Z tag upstream for each X.Y release,
+// preferring published releases to prereleases of the same version.
+func latestTags(c config) (map[string]string, error) {
+	out, err := capture("git", "ls-remote", "--tags", "--refs", c.upstreamURL(), "refs/tags/v*")
+	if err != nil {
+		return nil, fmt.Errorf("listing upstream tags: %w", err)
+	}
+	type version struct {
+		patch      int
+		prerelease string
+	}
+	latest := map[string]string{}
+	best := map[string]version{}
+	for _, line := range strings.Split(out, "\n") {
+		m := releaseTagRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		release := m[2] + "." + m[3]
+		patch, _ := strconv.Atoi(m[4])
+		v := version{patch: patch, prerelease: m[5]}
+		b, ok := best[release]
+		newer := !ok || v.patch > b.patch ||
+			(v.patch == b.patch && b.prerelease != "" && (v.prerelease == "" || v.prerelease > b.prerelease))
+		if newer {
+			best[release], latest[release] = v, m[1]
+		}
+	}
+	return latest, nil
+}
+
+// runReleases lists the upstream release branches with the --release value
+// that selects them, their latest tag, the date of their last commit, and
+// whether they accept backports. Release series without a published release
+// yet are in their stability period, in which only stability fixes are
+// usually accepted.
+func runReleases(ctx context.Context) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	releaseBranches, err := listReleaseBranches(ctx, c)
+	if err != nil {
+		return err
+	}
+	tags, err := latestTags(c)
+	if err != nil {
+		return err
+	}
+	windows, err := loadFreezeCalendar()
+	if err != nil {
+		return err
+	}
+	minMajor, minMinor, haveMin := parseReleaseVersion(gitConfig("backport.minRelease"))
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BRANCH\t-r\tLATEST TAG\tLAST COMMIT\tSTATUS")
+	now := time.Now()
+	for _, branch := range releaseBranches {
+		ghBranch, _, err := c.ghClient.Repositories.GetBranch(ctx, c.upstreamOwner, c.upstreamRepo, branch)
+		if err != nil {
+			return fmt.Errorf("fetching branch %s: %w", branch, err)
+		}
+		lastCommit := ghBranch.GetCommit().GetCommit().GetCommitter().GetDate().Format("2006-01-02")
+
+		release := strings.TrimPrefix(branch, "release-")
+		tag := "-"
+		major, minor, ok := parseReleaseVersion(branch)
+		if ok {
+			if t, found := tags[fmt.Sprintf("%d.%d", major, minor)]; found {
+				tag = t
+			}
+		}
+		// Tags of published releases have no prerelease suffix, e.g. -beta.1.
+		stabilizing := isSeriesBranch(branch) && (tag == "-" || strings.Contains(tag, "-"))
+
+		status := "open"
+		if ok && haveMin && (major < minMajor || (major == minMajor && minor < minMinor)) {
+			status = "unsupported"
+		} else if fw, frozen := activeFreeze(windows, branch, now); frozen {
+			status = "frozen until " + fw.end.Format("2006-01-02")
+		} else {
+			for _, fw := range windows {
+				if fw.branch == branch && now.Before(fw.start) {
+					status = fmt.Sprintf("open; frozen %s to %s",
+						fw.start.Format("2006-01-02"), fw.end.Format("2006-01-02"))
+					break
+				}
+			}
+		}
+		if stabilizing {
+			status += "; stability period"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", branch, release, tag, lastCommit, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	infof("%s", strings.TrimSuffix(table.String(), "\n"))
+	return nil
+}
@@ -0,0 +1,142 @@
+package backport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Renderer presents backport's own output: notes on its progress, reports
+// such as the list of stale backports, warnings, the text of interactive
+// prompts, and fatal errors. The output of the Git commands that backport runs
+// is not rendered; it goes straight to stdout and stderr.
+type Renderer interface {
+	// Info presents informational output. A message may span several lines;
+	// an empty message separates groups of messages.
+	Info(msg string)
+	// Warn presents a warning.
+	Warn(msg string)
+	// Prompt presents text that asks for input on stdin, without a trailing
+	// newline if the input is to follow on the same line.
+	Prompt(text string)
+	// Fatal presents the error that stopped backport, along with a hint on how
+	// to proceed, which may be empty.
+	Fatal(msg, hint string)
+}
+
+var renderer Renderer = TextRenderer{Stdout: os.Stdout, Stderr: os.Stderr}
+
+// SetRenderer directs all further output of this package to r.
+func SetRenderer(r Renderer) {
+	renderer = r
+}
+
+func infof(format string, args ...interface{}) {
+	renderer.Info(fmt.Sprintf(format, args...))
+}
+
+func warnf(format string, args ...interface{}) {
+	renderer.Warn(fmt.Sprintf(format, args...))
+}
+
+// TextRenderer renders output as plain text, with informational output on
+// Stdout and everything else on Stderr.
+type TextRenderer struct {
+	Stdout, Stderr io.Writer
+}
+
+// Info implements Renderer.
+func (r TextRenderer) Info(msg string) { fmt.Fprintln(r.Stdout, msg) }
+
+// Warn implements Renderer.
+func (r TextRenderer) Warn(msg string) { fmt.Fprintf(r.Stderr, "warning: %s\n", msg) }
+
+// Prompt implements Renderer.
+func (r TextRenderer) Prompt(text string) { fmt.Fprint(r.Stderr, text) }
+
+// Fatal implements Renderer.
+func (r TextRenderer) Fatal(msg, hint string) {
+	fmt.Fprintf(r.Stderr, "fatal: %s\n", msg)
+	if hint != "" {
+		fmt.Fprintf(r.Stderr, "hint: %s\n", hint)
+	}
+}
+
+// TTYRenderer renders output like TextRenderer, but highlights notes,
+// warnings, and errors with ANSI colors for display in a terminal.
+type TTYRenderer struct {
+	TextRenderer
+}
+
+const (
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiDim    = "\x1b[2m"
+	ansiReset  = "\x1b[0m"
+)
+
+// Info implements Renderer.
+func (r TTYRenderer) Info(msg string) {
+	if rest := strings.TrimPrefix(msg, "Note:"); rest != msg {
+		msg = ansiBold + "Note:" + ansiReset + rest
+	}
+	fmt.Fprintln(r.Stdout, msg)
+}
+
+// Warn implements Renderer.
+func (r TTYRenderer) Warn(msg string) {
+	fmt.Fprintf(r.Stderr, "%swarning:%s %s\n", ansiYellow, ansiReset, msg)
+}
+
+// Fatal implements Renderer.
+func (r TTYRenderer) Fatal(msg, hint string) {
+	fmt.Fprintf(r.Stderr, "%sfatal:%s %s\n", ansiRed, ansiReset, msg)
+	if hint != "" {
+		fmt.Fprintf(r.Stderr, "%shint:%s %s\n", ansiDim, ansiReset, hint)
+	}
+}
+
+// JSONRenderer renders each message as a JSON object on a line of its own,
+// e.g. {"time":"...","level":"warning","message":"..."}, for consumption by
+// other programs. The levels are "info", "warning", "prompt", and "fatal";
+// fatal messages carry their hint in a "hint" field. While a JSONRenderer is
+// in use, the output of Git commands goes to stderr, so that W can be stdout.
+type JSONRenderer struct {
+	W io.Writer
+}
+
+type jsonMessage struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Hint    string    `json:"hint,omitempty"`
+}
+
+func (r JSONRenderer) write(level, msg, hint string) {
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		// Blank lines only lay out text output.
+		return
+	}
+	out, err := json.Marshal(jsonMessage{Time: time.Now().UTC(), Level: level, Message: msg, Hint: hint})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(r.W, "%s\n", out)
+}
+
+// Info implements Renderer.
+func (r JSONRenderer) Info(msg string) { r.write("info", msg, "") }
+
+// Warn implements Renderer.
+func (r JSONRenderer) Warn(msg string) { r.write("warning", msg, "") }
+
+// Prompt implements Renderer.
+func (r JSONRenderer) Prompt(text string) { r.write("prompt", text, "") }
+
+// Fatal implements Renderer.
+func (r JSONRenderer) Fatal(msg, hint string) { r.write("fatal", msg, hint) }
@@ -0,0 +1,163 @@
+package backport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// retryAttempts is how many times a GitHub API request is attempted
+	// before its failure is reported.
+	retryAttempts = 4
+	// retryBaseWait is the wait before the first retry, which doubles with
+	// every further retry.
+	retryBaseWait = time.Second
+	// maxRetryWait is the longest wait before a retry. Responses that ask to
+	// wait longer, as when the primary rate limit is exhausted, are reported
+	// instead.
+	maxRetryWait = time.Minute
+)
+
+// retryTransport retries GitHub API requests that fail transiently: on
+// network errors and timeouts, server errors, and secondary rate limits,
+// which GitHub also calls abuse detection. Each attempt gets its own
+// timeout. Retries back off exponentially, with jitter, or wait as long as
+// the response's Retry-After header asks. Only GET and HEAD requests, and
+// requests whose context is marked with readOnly, are retried, as retrying
+// others, e.g. creating a PR, could repeat their effect.
+type retryTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration // of each attempt
+}
+
+// newRetryTransport returns a retryTransport that sends requests with base,
+// or with http.DefaultTransport if base is nil.
+func newRetryTransport(base http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &retryTransport{base: base, timeout: timeout}
+}
+
+type readOnlyKey struct{}
+
+// readOnly marks the requests made with the returned context as free of side
+// effects, and thus safe to retry, whatever their method, e.g. GraphQL
+// queries, which are POST requests.
+func readOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead &&
+		(req.Context().Value(readOnlyKey{}) == nil || (req.Body != nil && req.GetBody == nil)) {
+		return t.attempt(req)
+	}
+	for i := 1; ; i++ {
+		res, err := t.attempt(req)
+		if i == retryAttempts || req.Context().Err() != nil {
+			return res, err
+		}
+		var why string
+		wait := retryBaseWait << uint(i-1)
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)))
+		if err != nil {
+			why = err.Error()
+		} else if why = retryReason(res); why == "" {
+			return res, nil
+		} else if s := res.Header.Get("Retry-After"); s != "" {
+			secs, convErr := strconv.Atoi(s)
+			if convErr != nil || time.Duration(secs)*time.Second > maxRetryWait {
+				return res, nil
+			}
+			wait = time.Duration(secs) * time.Second
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return res, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+		warnf("GitHub API request failed (%s); retrying in %s", why, wait.Round(100*time.Millisecond))
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		// The body of the previous attempt has been consumed.
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// attempt sends req once, subject to the timeout of a single attempt, which
+// covers reading the response body too.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	res, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// retryReason returns why res is worth retrying, or "" if it is not.
+func retryReason(res *http.Response) string {
+	switch res.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return res.Status
+	case http.StatusTooManyRequests:
+		return "secondary rate limit"
+	case http.StatusForbidden:
+		// A 403 is also returned for exhausting the primary rate limit, which
+		// lasts up to an hour, and for lack of permission, neither of which
+		// is worth retrying.
+		if res.Header.Get("X-RateLimit-Remaining") == "0" {
+			return ""
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{bytes.NewReader(body), res.Body}
+		if err != nil {
+			return ""
+		}
+		msg := strings.ToLower(string(body))
+		if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse") {
+			return "secondary rate limit"
+		}
+	}
+	return ""
+}
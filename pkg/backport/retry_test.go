@@ -0,0 +1,56 @@
+package backport
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRetryReason(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		status    int
+		remaining string
+		body      string
+		want      string
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "unprocessable", status: http.StatusUnprocessableEntity},
+		{name: "server error", status: http.StatusInternalServerError, want: "500 Internal Server Error"},
+		{name: "bad gateway", status: http.StatusBadGateway, want: "502 Bad Gateway"},
+		{name: "unavailable", status: http.StatusServiceUnavailable, want: "503 Service Unavailable"},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, want: "504 Gateway Timeout"},
+		{name: "too many requests", status: http.StatusTooManyRequests, want: "secondary rate limit"},
+		{name: "secondary rate limit", status: http.StatusForbidden,
+			body: `{"message": "You have exceeded a secondary rate limit."}`, want: "secondary rate limit"},
+		{name: "abuse", status: http.StatusForbidden,
+			body: `{"message": "You have triggered an abuse detection mechanism."}`, want: "secondary rate limit"},
+		{name: "primary rate limit", status: http.StatusForbidden, remaining: "0",
+			body: `{"message": "API rate limit exceeded"}`},
+		{name: "forbidden", status: http.StatusForbidden, body: `{"message": "Resource not accessible"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: tc.status,
+				Status:     http.StatusText(tc.status),
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(tc.body)),
+			}
+			if tc.status >= 500 {
+				res.Status = tc.want
+			}
+			if tc.remaining != "" {
+				res.Header.Set("X-RateLimit-Remaining", tc.remaining)
+			}
+			if got := retryReason(res); got != tc.want {
+				t.Errorf("retryReason = %q, want %q", got, tc.want)
+			}
+			// The body must remain readable for the caller.
+			if body, err := ioutil.ReadAll(res.Body); err != nil || string(body) != tc.body {
+				t.Errorf("body after retryReason = %q, %v, want %q", body, err, tc.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// loadApprovers records the users who approved each of the PRs.
+func (prs pullRequests) loadApprovers(ctx context.Context, c config) error {
+	for i := range prs {
+		if prs[i].isRaw() {
+			continue
+		}
+		opt := &github.ListOptions{PerPage: 100}
+		for {
+			reviews, res, err := c.ghClient.PullRequests.ListReviews(ctx, c.upstreamOwner, c.upstreamRepo,
+				prs[i].number, opt)
+			if err != nil {
+				return fmt.Errorf("fetching reviews of PR #%d: %w", prs[i].number, err)
+			}
+			for _, r := range reviews {
+				if r.GetState() == "APPROVED" {
+					prs[i].approvers = append(prs[i].approvers, r.GetUser().GetLogin())
+				}
+			}
+			if res.NextPage == 0 {
+				break
+			}
+			opt.Page = res.NextPage
+		}
+	}
+	return nil
+}
+
+// reviewers returns the users to request review of the backport of prs from:
+// the authors and approvers of the selected PRs, except for self, who cannot
+// review their own PR, and bots.
+func (prs pullRequests) reviewers(self string) []string {
+	seen := map[string]bool{strings.ToLower(self): true}
+	var reviewers []string
+	for _, pr := range prs.selectedPRs() {
+		for _, login := range append([]string{pr.author}, pr.approvers...) {
+			if login == "" || strings.HasSuffix(login, "[bot]") || seen[strings.ToLower(login)] {
+				continue
+			}
+			seen[strings.ToLower(login)] = true
+			reviewers = append(reviewers, login)
+		}
+	}
+	return reviewers
+}
+
+// requestReviews requests reviews of the backport PR prNo from reviewers and
+// from the upstream owner's teams named by the multi-valued
+// backport.reviewTeam option, and returns those it requested reviews from.
+// Teams that do not exist, or that the token cannot see, are skipped with a
+// warning. A single reviewer that cannot be requested, e.g. because they are
+// no longer a collaborator, fails the request for all of them, in which case
+// reviews are requested one at a time so that only that reviewer is skipped.
+func requestReviews(ctx context.Context, c config, prNo int, reviewers []string) []string {
+	var teams []string
+	for _, slug := range gitConfigAll("backport.reviewTeam") {
+		slug = strings.TrimPrefix(strings.TrimPrefix(slug, "@"), c.upstreamOwner+"/")
+		if teamExists(ctx, c, slug, "not requesting its review") {
+			teams = append(teams, slug)
+		}
+	}
+	if len(reviewers) == 0 && len(teams) == 0 {
+		return nil
+	}
+
+	var requested []string
+	request := func(req github.ReviewersRequest) error {
+		_, _, err := c.ghClient.PullRequests.RequestReviewers(ctx, c.upstreamOwner, c.upstreamRepo, prNo, req)
+		if err == nil {
+			requested = append(requested, req.Reviewers...)
+			for _, team := range req.TeamReviewers {
+				requested = append(requested, c.upstreamOwner+"/"+team)
+			}
+		}
+		return err
+	}
+	if err := request(github.ReviewersRequest{Reviewers: reviewers, TeamReviewers: teams}); err == nil {
+		return requested
+	} else if len(reviewers)+len(teams) == 1 {
+		warnf("unable to request reviews on #%d: %s", prNo, err)
+		return nil
+	}
+	for _, login := range reviewers {
+		if err := request(github.ReviewersRequest{Reviewers: []string{login}}); err != nil {
+			warnf("unable to request review from %s on #%d: %s", login, prNo, err)
+		}
+	}
+	for _, team := range teams {
+		if err := request(github.ReviewersRequest{TeamReviewers: []string{team}}); err != nil {
+			warnf("unable to request review from %s/%s on #%d: %s", c.upstreamOwner, team, prNo, err)
+		}
+	}
+	return requested
+}
+
+// teamExists returns whether the upstream owner has the team slug, warning
+// that the team is skipped, as explained by skipping, if it does not or it
+// cannot be looked up.
+func teamExists(ctx context.Context, c config, slug, skipping string) bool {
+	_, res, err := c.ghClient.Teams.GetTeamBySlug(ctx, c.upstreamOwner, slug)
+	if err == nil {
+		return true
+	}
+	if res != nil && res.StatusCode == http.StatusNotFound {
+		warnf("team %s/%s does not exist or is not visible with your token; %s",
+			c.upstreamOwner, slug, skipping)
+	} else {
+		warnf("unable to look up team %s/%s: %s; %s", c.upstreamOwner, slug, err, skipping)
+	}
+	return false
+}
+
+// resolveReleaseTeam returns the mention of the upstream team to notify of
+// backports in their PR bodies, e.g. @cockroachdb/release, or nothing. The
+// team is named by backport.releaseTeam, which defaults to release for
+// cockroachdb repositories, and can be set to none to mention no team.
+// Teams can only be looked up with a token, so without one, the configured
+// team is mentioned as is.
+func resolveReleaseTeam(ctx context.Context, c config) string {
+	slug := gitConfig("backport.releaseTeam")
+	if slug == "" && strings.EqualFold(c.upstreamOwner, "cockroachdb") {
+		slug = "release"
+	}
+	slug = strings.TrimPrefix(strings.TrimPrefix(slug, "@"), c.upstreamOwner+"/")
+	if slug == "" || slug == "none" {
+		return ""
+	}
+	if c.authenticated && !teamExists(ctx, c, slug, "not mentioning it") {
+		return ""
+	}
+	return "@" + c.upstreamOwner + "/" + slug
+}
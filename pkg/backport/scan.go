@@ -0,0 +1,228 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// scanConflictLabel marks the PRs that Scan failed to backport automatically.
+// Scan skips PRs that carry it.
+const scanConflictLabel = "backport-failed"
+
+// ScanOptions controls Scan.
+type ScanOptions struct {
+	Since    time.Duration // how far back to look for merged PRs
+	NoVerify bool          // skip the backport.lint checks
+}
+
+// Scan backports the recently merged PRs that carry backport-X.Y.x labels but
+// have not been backported yet. Each backport is attempted in a temporary
+// worktree and opened as a PR via the API. If a backport conflicts, or fails
+// because of the PR itself, it is abandoned, and the source PR is labeled and
+// commented on so that someone can backport it by hand. Backports that fail
+// transiently, e.g. because GitHub is unreachable, are abandoned without a
+// trace, so that the next scan retries them. Scan never prompts for input, so
+// that it can be run periodically, e.g. from cron or CI.
+func Scan(ctx context.Context, opts ScanOptions) error {
+	defer saveState()()
+	force, noVerify, batch = false, opts.NoVerify, true
+	return runScan(ctx, opts.Since)
+}
+
+func runScan(ctx context.Context, since time.Duration) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if ok {
+		return errors.New("backport already in progress")
+	}
+
+	date := time.Now().Add(-since).UTC().Format("2006-01-02")
+	merged, err := searchPullRequests(ctx, c, fmt.Sprintf("is:merged base:master merged:>=%s", date))
+	if err != nil {
+		return err
+	}
+
+	var created, failed, deferred int
+	for _, pr := range merged {
+		var releases []string
+		skip := false
+		for _, label := range pr.Labels {
+			if label.GetName() == scanConflictLabel {
+				skip = true
+			} else if m := backportLabelRE.FindStringSubmatch(label.GetName()); m != nil {
+				releases = append(releases, m[1])
+			}
+		}
+		if skip {
+			continue
+		}
+		for _, release := range releases {
+			releaseBranch, err := resolveRelease(ctx, c, release)
+			if err != nil {
+				return err
+			}
+			if ok, err := hasBackport(ctx, c, pr.GetNumber(), releaseBranch); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+
+			infof("Backporting #%d to %s", pr.GetNumber(), releaseBranch)
+			err = runBackport(ctx, []string{strconv.Itoa(pr.GetNumber())}, Options{
+				Releases: []string{release},
+				CreatePR: true,
+				Worktree: true,
+			})
+			if err == nil {
+				created++
+				continue
+			}
+			warnf("backporting #%d to %s failed: %s", pr.GetNumber(), releaseBranch, err)
+			conflict, cErr := hadConflicts(c)
+			if cErr != nil {
+				return cErr
+			}
+			if err := abandonBackport(ctx, c); err != nil {
+				return err
+			}
+			if !conflict && isTransient(err) {
+				deferred++
+				infof("Skipping #%d for now; the next scan will retry it.", pr.GetNumber())
+				continue
+			}
+			failed++
+			if err := reportScanFailure(ctx, c, pr.GetNumber(), release, releaseBranch, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	infof("Created %d backport PR(s); %d backport(s) need manual attention.", created, failed)
+	if deferred > 0 {
+		infof("%d backport(s) failed transiently and will be retried.", deferred)
+	}
+	return nil
+}
+
+// fetchErr reports a failed fetch. Unlike other Git failures, which are
+// usually caused by the backport, fetches mostly fail because the network or
+// GitHub is down.
+type fetchErr struct{ error }
+
+func (e fetchErr) Unwrap() error { return e.error }
+
+// isTransient reports whether err, which failed a backport that did not
+// conflict, says nothing about the PR being backported: GitHub was
+// unreachable, slow, or failing, the rate limit ran out, or fetching from
+// upstream failed. Other errors, e.g. a squash-merged PR, a failed lint check,
+// or a push rejected because the backport branch exists, need a person.
+func isTransient(err error) bool {
+	var netErr net.Error
+	var fetchFailed fetchErr
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	var respErr *github.ErrorResponse
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return true
+	case errors.As(err, &fetchFailed):
+		return true
+	case errors.As(err, &rateErr), errors.As(err, &abuseErr):
+		return true
+	case errors.As(err, &respErr):
+		return respErr.Response != nil && respErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// hasBackport reports whether an open or merged backport of prNo to
+// releaseBranch exists.
+func hasBackport(ctx context.Context, c config, prNo int, releaseBranch string) (bool, error) {
+	for _, state := range []string{"is:open", "is:merged"} {
+		backports, err := findBackports(ctx, c, state, prNo, releaseBranch)
+		if err != nil || len(backports) > 0 {
+			return len(backports) > 0, err
+		}
+	}
+	return false, nil
+}
+
+// findBackports returns the backports of prNo to releaseBranch, or to any
+// branch if releaseBranch is empty, that match the given search qualifier,
+// e.g. "is:open", as identified by their bodies.
+func findBackports(
+	ctx context.Context, c config, state string, prNo int, releaseBranch string,
+) ([]github.Issue, error) {
+	query := fmt.Sprintf("%s %d in:body", state, prNo)
+	if releaseBranch != "" {
+		query = fmt.Sprintf("%s base:%s %d in:body", state, releaseBranch, prNo)
+	}
+	candidates, err := searchPullRequests(ctx, c, query)
+	if err != nil {
+		return nil, err
+	}
+	var backports []github.Issue
+	for _, bp := range candidates {
+		for _, src := range backportSources(bp.GetBody()) {
+			if src == prNo {
+				backports = append(backports, bp)
+				break
+			}
+		}
+	}
+	return backports, nil
+}
+
+// abandonBackport cancels the backport left in progress by a failed attempt,
+// if any, and deletes its branch.
+func abandonBackport(ctx context.Context, c config) error {
+	if ok, err := isBackporting(c); err != nil || !ok {
+		return err
+	}
+	pending, err := loadQueue(c)
+	if err != nil {
+		return err
+	}
+	if err := runAbort(ctx, false, false); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		if err := spawn("git", "branch", "-D", pending[0].BackportBranch); err != nil {
+			return fmt.Errorf("deleting backport branch %q: %w", pending[0].BackportBranch, err)
+		}
+	}
+	return nil
+}
+
+// reportScanFailure labels the source PR prNo and comments on it, explaining
+// that its backport to releaseBranch needs to be done by hand.
+func reportScanFailure(
+	ctx context.Context, c config, prNo int, release, releaseBranch string, backportErr error,
+) error {
+	comment := fmt.Sprintf("Automatic backport to %s failed:\n\n```\n%s\n```\n\n"+
+		"Please backport this PR manually, e.g. by running `backport %d -r %s`.",
+		releaseBranch, strings.TrimSpace(backportErr.Error()), prNo, release)
+	_, _, err := c.ghClient.Issues.CreateComment(ctx, c.upstreamOwner, c.upstreamRepo, prNo,
+		&github.IssueComment{Body: github.String(comment)})
+	if err != nil {
+		return fmt.Errorf("commenting on #%d: %w", prNo, err)
+	}
+	_, _, err = c.ghClient.Issues.AddLabelsToIssue(ctx, c.upstreamOwner, c.upstreamRepo, prNo,
+		[]string{scanConflictLabel})
+	if err != nil {
+		return fmt.Errorf("labeling #%d: %w", prNo, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-github/v29/github"
+)
+
+func TestIsTransient(t *testing.T) {
+	gitErr := exec.Command("false").Run()
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"timeout", fmt.Errorf("fetching PR #1: %w", context.DeadlineExceeded), true},
+		{"network", fmt.Errorf("fetching PR #1: %w", &net.OpError{Op: "dial", Err: errors.New("refused")}), true},
+		{"fetch", fmt.Errorf("fetching source branches: %w", fetchErr{gitErr}), true},
+		{"push", fmt.Errorf("pushing backport branch: %w", gitErr), false},
+		{"checkout", hintedErr{error: fmt.Errorf("creating backport branch: %w", gitErr)}, false},
+		{"rate limit", &github.RateLimitError{}, true},
+		{"abuse", &github.AbuseRateLimitError{}, true},
+		{"server error", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusBadGateway}}, true},
+		{"not found", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}}, false},
+		{"squash-merged", hintedErr{error: errors.New("PR #1 was squash-merged")}, false},
+	} {
+		if got := isTransient(tc.err); got != tc.want {
+			t.Errorf("%s: isTransient(%v) = %t, want %t", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package backport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDeepenAttempts is how many times deepenUntil deepens the fetched history
+// before it gives up and fetches all of it.
+const maxDeepenAttempts = 5
+
+// filterArgs returns the arguments that apply the object filter of --filter,
+// or backport.fetchFilter, to fetches from upstream, if there is one.
+func (c config) filterArgs() ([]string, error) {
+	if c.fetchFilter == "" {
+		return nil, nil
+	}
+	// Git only applies object filters when fetching from a promisor remote,
+	// and refuses to fetch from a URL with one.
+	if c.upstreamRemote == "" {
+		return nil, hintedErr{
+			error: fmt.Errorf("cannot fetch with filter %s: this is not a partial clone of %s/%s",
+				c.fetchFilter, c.upstreamOwner, c.upstreamRepo),
+			hint: fmt.Sprintf(`make a remote for upstream a promisor remote, e.g., if it is named
+upstream:
+
+    $ git config remote.upstream.promisor true
+    $ git config remote.upstream.partialCloneFilter %s
+
+or clone with --filter=%[1]s to begin with.`, c.fetchFilter),
+		}
+	}
+	return []string{"--filter=" + c.fetchFilter}, nil
+}
+
+// parseFetchDepth parses the value of --depth or backport.fetchDepth.
+func parseFetchDepth(s string) (int, error) {
+	depth, err := strconv.Atoi(s)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("invalid fetch depth %q", s)
+	}
+	return depth, nil
+}
+
+// isShallow returns whether the repository is a shallow clone, i.e., whether
+// some of the history of its commits was left out.
+func isShallow() bool {
+	out, err := capture("git", "rev-parse", "--is-shallow-repository")
+	return err == nil && out == "true"
+}
+
+// deepenUntil deepens the history of the named upstream branches, fetched by
+// a shallow fetchUpstream, until ok reports that enough of it is present.
+// The deepening fetch refetches the same branches, so that FETCH_HEAD lists
+// them in the same order as before. The depth doubles with every attempt,
+// and if that does not satisfy ok, the full history is fetched instead.
+func deepenUntil(c config, branches []string, ok func() bool) error {
+	if c.fetchDepth == 0 || !isShallow() || ok() {
+		return nil
+	}
+	filterArgs, err := c.filterArgs()
+	if err != nil {
+		return err
+	}
+	for i, deepen := 0, c.fetchDepth; ; i, deepen = i+1, deepen*2 {
+		args := append([]string{"git", "fetch"}, filterArgs...)
+		if i == maxDeepenAttempts {
+			infof("The shallow history is still missing commits needed by the backport; fetching all of it.")
+			args = append(args, "--unshallow")
+		} else {
+			infof("The shallow history is missing commits needed by the backport; deepening it by %d.", deepen)
+			args = append(args, fmt.Sprintf("--deepen=%d", deepen))
+		}
+		args = append(args, c.upstreamURL())
+		for _, branch := range branches {
+			args = append(args, "refs/heads/"+branch)
+		}
+		if err := spawn(args...); err != nil {
+			return fmt.Errorf("deepening history: %w", fetchErr{err})
+		}
+		// Deepening may have fetched all of the history already.
+		if i == maxDeepenAttempts || ok() || !isShallow() {
+			return nil
+		}
+	}
+}
+
+// haveMergeHistory returns whether the history needed to find the commits
+// that the PRs landed as, and the parents of those commits, is present.
+func (prs pullRequests) haveMergeHistory() bool {
+	for _, pr := range prs {
+		if pr.mergeCommit == "" {
+			continue
+		}
+		out, err := capture("git", "rev-list", "--parents", "-n1", pr.mergeCommit)
+		if err != nil {
+			// The merge commit is missing altogether, as it is for PRs merged
+			// by a merge queue, whose landed commits are found by searching
+			// the history of master, the first branch in FETCH_HEAD, which
+			// must thus reach back to when they merged.
+			before := pr.mergedAt.Add(-time.Hour).Unix()
+			out, err := capture("git", "rev-list", "-n1", "--first-parent",
+				fmt.Sprintf("--before=%d", before), "FETCH_HEAD")
+			if err != nil || out == "" {
+				return false
+			}
+			continue
+		}
+		parents := strings.Fields(out)[1:]
+		switch {
+		case len(parents) >= 2:
+			if _, err := capture("git", "merge-base", parents[0], parents[1]); err != nil {
+				return false
+			}
+		case len(parents) == 1:
+			// Rebased PRs landed as the last len(pr.commits) commits of the
+			// first-parent history, whose parent must be present too.
+			rev := fmt.Sprintf("%s~%d^{commit}", pr.mergeCommit, len(pr.commits))
+			if _, err := capture("git", "rev-parse", "--verify", "--quiet", rev); err != nil {
+				return false
+			}
+		default:
+			// A commit at the edge of the shallow history has no parents.
+			return false
+		}
+	}
+	return true
+}
+
+// haveParents returns whether the commits and their parents are present,
+// which cherry-picking them requires.
+func haveParents(commits []string) bool {
+	for _, sha := range commits {
+		if _, err := capture("git", "rev-parse", "--verify", "--quiet", sha+"^^{commit}"); err != nil {
+			return false
+		}
+	}
+	return true
+}
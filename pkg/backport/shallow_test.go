@@ -0,0 +1,50 @@
+package backport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFetchDepth(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "1", want: 1},
+		{in: "500", want: 500},
+		{in: "-1", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "1.5", wantErr: true},
+	} {
+		got, err := parseFetchDepth(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseFetchDepth(%q): got error %v, want error: %t", tc.in, err, tc.wantErr)
+		} else if got != tc.want {
+			t.Errorf("parseFetchDepth(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		c       config
+		want    []string
+		wantErr bool
+	}{
+		{name: "no filter", c: config{}},
+		{name: "no filter or promisor", c: config{upstreamRemote: "upstream"}},
+		{name: "promisor", c: config{fetchFilter: "blob:none", upstreamRemote: "upstream"}, want: []string{"--filter=blob:none"}},
+		{name: "no promisor", c: config{fetchFilter: "blob:none"}, wantErr: true},
+	} {
+		got, err := tc.c.filterArgs()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", tc.name, err, tc.wantErr)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
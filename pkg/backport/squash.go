@@ -0,0 +1,81 @@
+package backport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// squashedPR describes how to squash the commits cherry-picked from one PR.
+type squashedPR struct {
+	Count   int    `json:"count"`   // number of commits to squash
+	Message string `json:"message"` // message of the squashed commit
+}
+
+// squashPlan returns the squashes that collapse each of the PRs' selected
+// commits into a single commit, in cherry-pick order.
+func (prs pullRequests) squashPlan() []squashedPR {
+	var plan []squashedPR
+	for _, pr := range prs.selectedPRs() {
+		var s strings.Builder
+		if pr.isRaw() {
+			fmt.Fprintf(&s, "%s\n\nBackport squashing %d commit(s):\n", pr.subject(pr.selectedCommits[0]), len(pr.selectedCommits))
+		} else {
+			fmt.Fprintf(&s, "%s\n\nBackport of #%d, squashing %d commit(s):\n", pr.title, pr.number, len(pr.selectedCommits))
+		}
+		for _, sha := range pr.selectedCommits {
+			fmt.Fprintf(&s, "\n%s\n", strings.TrimSpace(pr.messages[sha]))
+		}
+		plan = append(plan, squashedPR{Count: len(pr.selectedCommits), Message: s.String()})
+	}
+	return plan
+}
+
+// squashCommits rewrites the commits on the backport branch for p, which must
+// be checked out, according to p.Squash. The resulting trees are unchanged;
+// only the history is collapsed.
+func squashCommits(c config, p pendingBackport) error {
+	err := fetchBranches(c, p.DestBranch)
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", p.DestBranch, err)
+	}
+	base, err := capture("git", "merge-base", "FETCH_HEAD", "HEAD")
+	if err != nil {
+		return fmt.Errorf("finding base of backport branch: %w", err)
+	}
+	out, err := capture("git", "rev-list", "--reverse", base+"..HEAD")
+	if err != nil {
+		return fmt.Errorf("listing backported commits: %w", err)
+	}
+	commits := strings.Fields(out)
+
+	var want int
+	for _, s := range p.Squash {
+		want += s.Count
+	}
+	if len(commits) == len(p.Squash) {
+		// Already squashed, e.g. by an earlier 'backport --continue' that
+		// failed to push.
+		return nil
+	}
+	if len(commits) != want {
+		return hintedErr{
+			error: fmt.Errorf("cannot squash: expected %d backported commits, found %d", want, len(commits)),
+			hint: `commits were added or skipped while resolving conflicts. Squash the
+commits by hand, e.g. with 'git rebase -i', then rerun 'backport --continue'.`,
+		}
+	}
+
+	parent, i := base, 0
+	for _, s := range p.Squash {
+		i += s.Count
+		last := commits[i-1]
+		parent, err = capture("git", "commit-tree", last+"^{tree}", "-p", parent, "-m", s.Message)
+		if err != nil {
+			return fmt.Errorf("squashing commits: %w", err)
+		}
+	}
+	if err := spawn("git", "reset", "--soft", parent); err != nil {
+		return fmt.Errorf("updating backport branch: %w", err)
+	}
+	return nil
+}
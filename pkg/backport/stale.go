@@ -0,0 +1,76 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultStaleThreshold is the number of commits a backport PR's base branch
+// may advance beyond it before the PR is considered stale, unless overridden
+// by backport.staleThreshold.
+const defaultStaleThreshold = 50
+
+// runStale lists the user's open backport PRs whose base branch has advanced
+// by at least the stale threshold since the PR was opened, or which no longer
+// merge cleanly into it.
+func runStale(ctx context.Context) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	threshold := defaultStaleThreshold
+	if s := gitConfig("backport.staleThreshold"); s != "" {
+		threshold, err = strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("parsing backport.staleThreshold: %w", err)
+		}
+	}
+
+	open, err := searchPullRequests(ctx, c, fmt.Sprintf("is:open author:%s", c.login))
+	if err != nil {
+		return err
+	}
+
+	var stale int
+	for _, issue := range open {
+		pr, _, err := c.ghClient.PullRequests.Get(ctx, c.upstreamOwner, c.upstreamRepo, issue.GetNumber())
+		if err != nil {
+			return fmt.Errorf("fetching PR #%d: %w", issue.GetNumber(), err)
+		}
+		if !backportBranchRE.MatchString(pr.GetHead().GetRef()) {
+			continue
+		}
+		base := pr.GetBase().GetRef()
+		comparison, _, err := c.ghClient.Repositories.CompareCommits(ctx,
+			c.upstreamOwner, c.upstreamRepo, base, pr.GetHead().GetSHA())
+		if err != nil {
+			return fmt.Errorf("comparing PR #%d with %s: %w", pr.GetNumber(), base, err)
+		}
+
+		var reasons []string
+		if behind := comparison.GetBehindBy(); behind >= threshold {
+			reasons = append(reasons, fmt.Sprintf("%d commits behind %s", behind, base))
+		}
+		// GitHub computes mergeability lazily, so an unknown state is not
+		// treated as a conflict.
+		if pr.Mergeable != nil && !pr.GetMergeable() {
+			reasons = append(reasons, fmt.Sprintf("conflicts with %s", base))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		if stale == 0 {
+			renderer.Info("Backport PRs that need a refresh:")
+		}
+		stale++
+		infof("    #%d  %s (%s)", pr.GetNumber(), pr.GetTitle(), strings.Join(reasons, ", "))
+	}
+
+	if stale == 0 {
+		renderer.Info("No stale backport PRs")
+	}
+	return nil
+}
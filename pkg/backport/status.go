@@ -0,0 +1,159 @@
+package backport
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// runStatus describes the in-progress backport, if any: the branch it is on,
+// which commits have been cherry-picked and which remain, whether a conflict
+// awaits resolution, and which backports are queued behind it.
+func runStatus(ctx context.Context) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := isBackporting(c); err != nil {
+		return err
+	} else if !ok {
+		renderer.Info("No backport in progress")
+		return nil
+	}
+
+	pending, err := loadQueue(c)
+	if err != nil {
+		return err
+	}
+	var current pendingBackport
+	if len(pending) > 0 {
+		current, pending = pending[0], pending[1:]
+	}
+	if err := enterWorktree(current); err != nil {
+		return err
+	}
+	if current.DestBranch == "" {
+		// Adopted backports have no queue entry.
+		in, err := ioutil.ReadFile(c.urlFile())
+		if err != nil {
+			return fmt.Errorf("reading url file: %w", err)
+		}
+		current.DestBranch, current.BackportBranch, err = parseCompareURL(string(in))
+		if err != nil {
+			return err
+		}
+	}
+
+	infof("Backporting to %s on branch %s", current.DestBranch, current.BackportBranch)
+	if current.Worktree != "" {
+		infof("Worktree: %s", current.Worktree)
+	}
+
+	cherryPicking, err := isCherryPicking()
+	if err != nil {
+		return err
+	}
+	var conflicting string
+	var remaining []string
+	if cherryPicking {
+		conflicting, err = capture("git", "rev-parse", "CHERRY_PICK_HEAD")
+		if err != nil {
+			return fmt.Errorf("looking up conflicting commit: %w", err)
+		}
+		remaining, err = sequencerTodo()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The commits are cherry-picked in order, so those before the conflicting
+	// one have been applied and those after it remain.
+	var applied []string
+	for _, sha := range current.Commits {
+		if sha == conflicting {
+			break
+		}
+		applied = append(applied, sha)
+	}
+	var rest []string
+	for _, sha := range current.Commits[len(applied):] {
+		if sha == conflicting {
+			continue
+		}
+		rest = append(rest, sha)
+	}
+	if len(current.Commits) == 0 {
+		// Without a queue entry, all that is known is what the sequencer
+		// still has to do.
+		rest = remaining
+	}
+
+	if len(applied) > 0 {
+		renderer.Info("\nApplied:")
+		printCommits(applied)
+	}
+	if conflicting != "" {
+		renderer.Info("\nStopped on a conflict in:")
+		printCommits([]string{conflicting})
+		files, err := capture("git", "diff", "--name-only", "--diff-filter=U")
+		if err != nil {
+			return fmt.Errorf("listing conflicting files: %w", err)
+		}
+		for _, file := range strings.Fields(files) {
+			infof("        %s", file)
+		}
+	}
+	if len(rest) > 0 {
+		renderer.Info("\nRemaining:")
+		printCommits(rest)
+	}
+	if len(pending) > 0 {
+		renderer.Info("\nQueued:")
+		for _, p := range pending {
+			infof("    %s on branch %s", p.DestBranch, p.BackportBranch)
+		}
+	}
+
+	if conflicting != "" {
+		renderer.Info("\nResolve the conflicts, then run 'backport --continue'.")
+	} else {
+		renderer.Info("\nRun 'backport --continue' to submit the backport.")
+	}
+	return nil
+}
+
+// sequencerTodo returns the abbreviated SHAs of the commits that an interrupted
+// multi-commit cherry-pick has yet to apply, excluding the one it stopped on,
+// which heads the todo list.
+func sequencerTodo() ([]string, error) {
+	path, err := capture("git", "rev-parse", "--git-path", "sequencer/todo")
+	if err != nil {
+		return nil, fmt.Errorf("locating sequencer state: %w", err)
+	}
+	in, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading sequencer state: %w", err)
+	}
+	var todo []string
+	for i, line := range strings.Split(string(in), "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 2 || fields[0] != "pick" {
+			continue
+		}
+		todo = append(todo, fields[1])
+	}
+	return todo, nil
+}
+
+// printCommits prints the abbreviated SHA and subject of each commit.
+func printCommits(shas []string) {
+	for _, sha := range shas {
+		subject, _ := capture("git", "show", "-s", "--format=%s", sha)
+		infof("    %.10s  %s", sha, subject)
+	}
+}
@@ -0,0 +1,97 @@
+package backport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+)
+
+// finished records a backport that finalize completed, for printSummary.
+type finished struct {
+	destBranch, backportBranch string
+	prURL                      string   // empty if the PR was left to open in a browser
+	reviewers                  []string // whose reviews were requested
+}
+
+// summary records the backports finished during a Run or Continue, and the
+// configuration they ran with, which is unset until backports start running.
+var summary struct {
+	c        *config
+	finished []finished
+}
+
+// printSummary closes a run of backports with what was done and what was
+// not, given the error that ended the run, if any, and the commands that take
+// it from there, so that users need not piece the state together from the
+// output of the Git commands. It prints nothing if no backport ran, e.g.
+// because of a bad argument or --dry-run.
+func printSummary(runErr error) {
+	if summary.c == nil {
+		return
+	}
+	c := *summary.c
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+	for _, f := range summary.finished {
+		what := fmt.Sprintf("pushed %s; submit the PR in your browser", f.backportBranch)
+		if f.prURL != "" {
+			what = f.prURL
+			if len(f.reviewers) > 0 {
+				what += " (reviewers: " + strings.Join(f.reviewers, ", ") + ")"
+			}
+		}
+		fmt.Fprintf(w, "    %s\tdone\t%s\n", f.destBranch, what)
+	}
+	summary.c, summary.finished = nil, nil
+
+	var next []string
+	if runErr != nil {
+		pending, _ := loadQueue(c)
+		backporting, _ := isBackporting(c)
+		if backporting {
+			var current pendingBackport
+			if len(pending) > 0 {
+				current, pending = pending[0], pending[1:]
+			} else if in, err := ioutil.ReadFile(c.urlFile()); err == nil {
+				// Adopted backports have no queue entry.
+				current.DestBranch, current.BackportBranch, _ = parseCompareURL(string(in))
+			}
+			if current.Worktree != "" {
+				next = append(next, "    $ cd "+current.Worktree)
+			}
+			state := "stopped before its PR was opened"
+			if conflicted, _ := hadConflicts(c); conflicted {
+				state = "stopped on a conflict"
+				next = append(next,
+					"    # resolve the conflicts, then stage them",
+					"    $ git add <path>...")
+			}
+			fmt.Fprintf(w, "    %s\t%s\ton %s\n", current.DestBranch, state, current.BackportBranch)
+			next = append(next, "    $ backport --continue")
+		} else if len(pending) > 0 {
+			// The backport failed before it started, e.g. while fetching.
+			fmt.Fprintf(w, "    %s\tnot started\n", pending[0].DestBranch)
+			pending = pending[1:]
+			next = append(next, "    # fix the error, then rerun the same backport command")
+		}
+		for _, p := range pending {
+			fmt.Fprintf(w, "    %s\tqueued\n", p.DestBranch)
+		}
+		if backporting {
+			if len(pending) > 0 {
+				next = append(next, fmt.Sprintf("    # which then starts the %d queued backport(s)", len(pending)))
+			}
+			next = append(next, "    # or, to give up:", "    $ backport --abort")
+		}
+	}
+	w.Flush()
+	if table.Len() == 0 {
+		return
+	}
+	msg := "\nSummary:\n" + strings.TrimRight(table.String(), "\n ")
+	if len(next) > 0 {
+		msg += "\n\nNext steps:\n" + strings.Join(next, "\n")
+	}
+	infof("%s", msg)
+}
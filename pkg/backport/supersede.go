@@ -0,0 +1,115 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// closeSuperseded closes the open backport PRs to the same branch as
+// replacement whose source PRs are all included in replacement, leaving a
+// comment that points to it.
+func closeSuperseded(ctx context.Context, c config, replacement *github.PullRequest) error {
+	sources := backportSources(replacement.GetBody())
+	if len(sources) == 0 {
+		return fmt.Errorf("unable to determine the source PRs of #%d", replacement.GetNumber())
+	}
+	included := map[int]bool{}
+	for _, prNo := range sources {
+		included[prNo] = true
+	}
+
+	base := replacement.GetBase().GetRef()
+	open, err := searchPullRequests(ctx, c, fmt.Sprintf("is:open base:%s", base))
+	if err != nil {
+		return err
+	}
+	for _, pr := range open {
+		if pr.GetNumber() == replacement.GetNumber() {
+			continue
+		}
+		prSources := backportSources(pr.GetBody())
+		if len(prSources) == 0 {
+			continue
+		}
+		superseded := true
+		for _, prNo := range prSources {
+			superseded = superseded && included[prNo]
+		}
+		if !superseded {
+			continue
+		}
+
+		comment := fmt.Sprintf("Superseded by #%d.", replacement.GetNumber())
+		_, _, err := c.ghClient.Issues.CreateComment(ctx, c.upstreamOwner, c.upstreamRepo,
+			pr.GetNumber(), &github.IssueComment{Body: github.String(comment)})
+		if err != nil {
+			return fmt.Errorf("commenting on #%d: %w", pr.GetNumber(), err)
+		}
+		_, _, err = c.ghClient.PullRequests.Edit(ctx, c.upstreamOwner, c.upstreamRepo,
+			pr.GetNumber(), &github.PullRequest{State: github.String("closed")})
+		if err != nil {
+			return fmt.Errorf("closing #%d: %w", pr.GetNumber(), err)
+		}
+		infof("Closed superseded backport PR #%d: %s", pr.GetNumber(), pr.GetTitle())
+	}
+	return nil
+}
+
+// checkDuplicateBackports refuses to backport prs to destBranch if an open
+// backport PR to that branch already covers one of them, as happens when two
+// people set out to backport the same change. Open backports that
+// closeSuperseded would close are fine. With --force, duplicates merely cause
+// a warning.
+func checkDuplicateBackports(
+	ctx context.Context, c config, destBranch string, prs pullRequests, closingSuperseded bool,
+) error {
+	included := map[int]bool{}
+	for _, pr := range prs {
+		included[pr.number] = true
+	}
+	var duplicates []string
+	seen := map[int]bool{}
+	for _, pr := range prs {
+		if pr.isRaw() {
+			continue
+		}
+		backports, err := findBackports(ctx, c, "is:open", pr.number, destBranch)
+		if err != nil {
+			return err
+		}
+		for _, bp := range backports {
+			if seen[bp.GetNumber()] {
+				continue
+			}
+			seen[bp.GetNumber()] = true
+			superseded := true
+			for _, src := range backportSources(bp.GetBody()) {
+				superseded = superseded && included[src]
+			}
+			if closingSuperseded && superseded {
+				continue
+			}
+			duplicates = append(duplicates, fmt.Sprintf("#%d (%s) by @%s already backports #%d to %s",
+				bp.GetNumber(), bp.GetTitle(), bp.GetUser().GetLogin(), pr.number, destBranch))
+		}
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	if force {
+		for _, d := range duplicates {
+			warnf("%s", d)
+		}
+		return nil
+	}
+	return hintedErr{
+		error: errors.New(strings.Join(duplicates, "\n")),
+		hint: `review or update the existing backport PR instead of opening another.
+To replace it, rerun with --close-superseded; to open another backport
+anyway, rerun with --force.`,
+	}
+}
@@ -0,0 +1,117 @@
+package backport
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplatePath is where the PR body template is looked for, relative
+// to the top of the repository, unless backport.template says otherwise.
+const defaultTemplatePath = ".github/BACKPORT_TEMPLATE.md"
+
+// templatePR describes one of the backported PRs to a body template.
+type templatePR struct {
+	Number          int
+	Title           string
+	Author          string
+	Body            string
+	BaseBranch      string
+	Commits         int // the number of commits in the PR
+	SelectedCommits int // the number of commits being backported
+}
+
+// templateData is the data passed to a body template.
+type templateData struct {
+	Branch        string // the destination branch, e.g. release-23.1
+	Release       string // the release of the destination branch, e.g. 23.1, if any
+	PRs           []templatePR
+	Justification string   // why an unsupported release is targeted, if it is
+	References    []string // the "Epic:" and "Informs:" lines of the PRs
+	Message       string   // the body that backport generates by default
+}
+
+// loadBodyTemplate returns the PR body template named by backport.template,
+// or found at defaultTemplatePath, or nil if there is none.
+func loadBodyTemplate() (*template.Template, error) {
+	path := gitConfig("backport.template")
+	if path == "" {
+		top, err := capture("git", "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, fmt.Errorf("looking up repository root: %w", err)
+		}
+		path = filepath.Join(top, defaultTemplatePath)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading PR body template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(string(in))
+	if err != nil {
+		return nil, fmt.Errorf("parsing PR body template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templatedMessage renders the backport of prs to destBranch with tmpl, whose
+// .Message mentions cc like message does.
+func (prs pullRequests) templatedMessage(
+	tmpl *template.Template, destBranch *destinationBranch, cc string,
+) (string, error) {
+	data := templateData{
+		Branch:        destBranch.branch,
+		Justification: destBranch.justification,
+		References:    prs.references(),
+		Message:       prs.message(destBranch, cc),
+	}
+	if m := releaseVersionRE.FindStringSubmatch(destBranch.branch); m != nil {
+		data.Release = m[1]
+	}
+	for _, pr := range prs.selectedPRs() {
+		data.PRs = append(data.PRs, templatePR{
+			Number:          pr.number,
+			Title:           pr.title,
+			Author:          pr.author,
+			Body:            neutralizeClosingKeywords(pr.body),
+			BaseBranch:      pr.baseBranch,
+			Commits:         len(pr.commits),
+			SelectedCommits: len(pr.selectedCommits),
+		})
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing PR body template: %w", err)
+	}
+	return withSourceMarkers(buf.String(), prs), nil
+}
+
+// withSourceMarkers appends a line naming each of the PRs that body does not
+// name in the form that backportSources recognizes, which the lookups of
+// existing backports, e.g. by --scan and --close-superseded, rely on, so that
+// templates need not keep the generated text.
+func withSourceMarkers(body string, prs pullRequests) string {
+	named := map[int]bool{}
+	for _, prNo := range backportSources(body) {
+		named[prNo] = true
+	}
+	var markers strings.Builder
+	for _, pr := range prs.selectedPRs() {
+		if !pr.isRaw() && !named[pr.number] {
+			named[pr.number] = true
+			fmt.Fprintf(&markers, "Backport of commits from #%d.\n", pr.number)
+		}
+	}
+	if markers.Len() == 0 {
+		return body
+	}
+	return strings.TrimRight(body, "\n") + "\n\n" + markers.String()
+}
@@ -0,0 +1,73 @@
+package backport
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// trailerData is the data passed to the backport.trailer templates.
+type trailerData struct {
+	Branch  string // the destination branch, e.g. release-23.2
+	Release string // the release of the destination branch, e.g. 23.2, if any
+	PRs     []int  // the numbers of the backported PRs
+}
+
+// configuredTrailers evaluates the templates in the multi-valued
+// backport.trailer option, e.g. "Release-branch: {{.Branch}}", for the
+// backport of prs to destBranch. Templates that evaluate to nothing are
+// dropped.
+func configuredTrailers(destBranch *destinationBranch, prs pullRequests) ([]string, error) {
+	data := trailerData{Branch: destBranch.branch}
+	if m := releaseVersionRE.FindStringSubmatch(destBranch.branch); m != nil {
+		data.Release = m[1]
+	}
+	for _, pr := range prs.selectedPRs() {
+		if !pr.isRaw() {
+			data.PRs = append(data.PRs, pr.number)
+		}
+	}
+	var trailers []string
+	for _, text := range gitConfigAll("backport.trailer") {
+		tmpl, err := template.New("trailer").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing backport.trailer %q: %w", text, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("executing backport.trailer %q: %w", text, err)
+		}
+		if trailer := strings.TrimSpace(buf.String()); trailer != "" {
+			trailers = append(trailers, trailer)
+		}
+	}
+	return trailers, nil
+}
+
+// addTrailers appends p.Trailers to the message of every commit on the
+// backport branch, unless the commit already has them.
+func addTrailers(c config, p pendingBackport) error {
+	err := fetchBranches(c, p.DestBranch)
+	if err != nil {
+		return fmt.Errorf("fetching %q branch: %w", p.DestBranch, err)
+	}
+	base, err := capture("git", "merge-base", "FETCH_HEAD", "HEAD")
+	if err != nil {
+		return fmt.Errorf("finding base of backport branch: %w", err)
+	}
+	cmd := "git log -n1 --format=%B | git interpret-trailers --if-exists addIfDifferent"
+	for _, trailer := range p.Trailers {
+		cmd += " --trailer " + shellQuote(trailer)
+	}
+	cmd += " | git commit --amend --no-verify --quiet -F -"
+	if err := spawn("git", "rebase", "--quiet", "--exec", cmd, base); err != nil {
+		return fmt.Errorf("adding trailers: %w", err)
+	}
+	return nil
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell command.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
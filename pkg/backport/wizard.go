@@ -0,0 +1,296 @@
+package backport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// wizardReleaseCount is how many of the newest releases the wizard offers.
+const wizardReleaseCount = 6
+
+// Wizard walks the user through a backport step by step: choosing the PRs,
+// their commits, and the releases, previewing conflicts, and confirming the
+// equivalent backport command, which it then runs with opts.
+func Wizard(ctx context.Context, opts Options) error {
+	defer saveState()()
+	force, noVerify = opts.Force, opts.NoVerify
+	remoteOverride = opts.Remote
+	if !isInteractive() {
+		return hintedErr{
+			error: errors.New("the wizard requires a terminal"),
+			hint: `pass the PRs and releases to backport as arguments instead, e.g.
+'backport 123 -r 23.1'.`,
+		}
+	}
+	if err := runWizard(ctx, &opts); err != nil {
+		return err
+	}
+	return Run(ctx, opts)
+}
+
+// runWizard fills in the PRs, commits, and releases of opts from the user's
+// answers.
+func runWizard(ctx context.Context, opts *Options) error {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Step 1: the PRs.
+	prNos, err := wizardPickPRs(ctx, c, opts.Releases)
+	if err != nil {
+		return err
+	}
+	prs, err := loadPullRequests(ctx, c, prNos)
+	if err != nil {
+		return err
+	}
+	if err := checkUnmerged(prs); err != nil {
+		return err
+	}
+	if err := fetchBranches(c, "master"); err != nil {
+		return fmt.Errorf("fetching master: %w", err)
+	}
+
+	// Step 2: the commits.
+	var commits int
+	for _, pr := range prs {
+		commits += len(pr.commits)
+	}
+	if commits > len(prs) {
+		answer, err := prompt(fmt.Sprintf("Backport all %d commits? [Y/n] ", commits))
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(strings.ToLower(answer), "n") {
+			if err := prs.pickCommits(); err != nil {
+				return err
+			}
+			for _, pr := range prs {
+				if len(pr.selectedCommits) != len(pr.commits) {
+					for _, sha := range pr.selectedCommits {
+						opts.Commits = append(opts.Commits, fmt.Sprintf("%d:%s", pr.number, sha))
+					}
+				}
+			}
+		}
+	}
+	if err := prs.useLandedCommits(); err != nil {
+		return err
+	}
+
+	// Step 3: the releases.
+	opts.Releases, err = wizardPickReleases(ctx, c, prs)
+	if err != nil {
+		return err
+	}
+
+	// Step 4: the conflicts.
+	infof("\nChecking whether the commits apply cleanly...")
+	for _, release := range opts.Releases {
+		branch := releaseBranchName(release)
+		conflicts, err := previewConflicts(c, branch, prs.selectedCommits())
+		if err != nil {
+			warnf("unable to check %s: %s", branch, err)
+		} else if len(conflicts) == 0 {
+			infof("    %s: applies cleanly", branch)
+		} else {
+			infof("    %s: conflicts in %s", branch, strings.Join(conflicts, ", "))
+		}
+	}
+
+	// Step 5: confirmation.
+	args := []string{"backport"}
+	for _, prNo := range prNos {
+		args = append(args, strconv.Itoa(prNo))
+	}
+	for _, release := range opts.Releases {
+		args = append(args, "-r", release)
+	}
+	for _, commit := range opts.Commits {
+		args = append(args, "-c", commit)
+	}
+	infof("\nThis is equivalent to running:\n\n    $ %s\n", strings.Join(args, " "))
+	answer, err := prompt("Proceed? [Y/n] ")
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(strings.ToLower(answer), "n") {
+		return errors.New("backport cancelled")
+	}
+	for _, prNo := range prNos {
+		opts.PRs = append(opts.PRs, strconv.Itoa(prNo))
+	}
+	return nil
+}
+
+// wizardPickPRs asks for PRs to backport, either directly by number or from
+// the results of a search among merged PRs. If a single release was given,
+// e.g. with 'backport wizard -r 23.1', the PRs labeled for backport to it are
+// offered instead of the user's recently merged PRs.
+func wizardPickPRs(ctx context.Context, c config, releases []string) ([]int, error) {
+	offered := "your recently merged PRs"
+	if len(releases) == 1 {
+		offered = "the merged PRs labeled for " + releases[0]
+	}
+	answer, err := prompt("Which PRs do you want to backport? Enter their numbers, or words to\n" +
+		"search for among merged PRs, or nothing to list " + offered + ": ")
+	if err != nil {
+		return nil, err
+	}
+	if answer != "" {
+		if prNos, err := parsePRArgs(c, strings.Fields(answer)); err == nil {
+			return prNos, nil
+		}
+	}
+
+	var issues []github.Issue
+	if answer == "" && len(releases) == 1 {
+		branch, err := resolveRelease(ctx, c, releases[0])
+		if err != nil {
+			return nil, err
+		}
+		if issues, err = labeledPRs(ctx, c, branch); err != nil {
+			return nil, err
+		}
+	} else {
+		query := fmt.Sprintf("repo:%s/%s is:pr is:merged base:master ", c.upstreamOwner, c.upstreamRepo)
+		if answer == "" {
+			query += "author:" + c.login
+		} else {
+			query += answer
+		}
+		res, _, err := c.ghClient.Search.Issues(ctx, query, &github.SearchOptions{
+			Sort:        "updated",
+			Order:       "desc",
+			ListOptions: github.ListOptions{PerPage: 15},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("searching pull requests (%s): %w", query, err)
+		}
+		issues = res.Issues
+	}
+	if len(issues) == 0 {
+		return nil, fmt.Errorf("no merged PRs found for %q", answer)
+	}
+	var list strings.Builder
+	for i, issue := range issues {
+		fmt.Fprintf(&list, "    %d) #%d  %s (@%s)\n", i+1, issue.GetNumber(), issue.GetTitle(), issue.GetUser().GetLogin())
+	}
+	renderer.Prompt(list.String())
+	answer, err = prompt(fmt.Sprintf("Which of these? [1-%d, e.g. 1 3] ", len(issues)))
+	if err != nil {
+		return nil, err
+	}
+	choices, err := parseChoices(answer, len(issues))
+	if err != nil {
+		return nil, err
+	}
+	if len(choices) == 0 {
+		return nil, errors.New("no PRs selected")
+	}
+	var prNos []int
+	for _, n := range choices {
+		prNos = append(prNos, issues[n-1].GetNumber())
+	}
+	return prNos, nil
+}
+
+// wizardPickReleases lets the user check the releases to backport prs to
+// among the newest releases, starting with those requested by the PRs'
+// backport labels, or the newest release if there are none.
+func wizardPickReleases(ctx context.Context, c config, prs pullRequests) ([]string, error) {
+	branches, err := listReleaseBranches(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	branches = seriesBranches(branches)
+	var releases []string
+	for i := len(branches) - 1; i >= 0 && len(releases) < wizardReleaseCount; i-- {
+		releases = append(releases, strings.TrimPrefix(branches[i], "release-"))
+	}
+	if len(releases) == 0 {
+		return nil, errors.New("no release branches found")
+	}
+
+	checked := map[string]bool{}
+	for _, release := range prs.labeledReleases() {
+		checked[release] = true
+	}
+	if len(checked) == 0 {
+		checked[releases[0]] = true
+	}
+	for {
+		var list strings.Builder
+		for i, release := range releases {
+			mark := " "
+			if checked[release] {
+				mark = "x"
+			}
+			fmt.Fprintf(&list, "  [%s] %d) %s\n", mark, i+1, release)
+		}
+		renderer.Prompt(list.String())
+		answer, err := prompt("Toggle releases by number, or press enter to continue: ")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			var picked []string
+			for _, release := range releases {
+				if checked[release] {
+					picked = append(picked, release)
+				}
+			}
+			if len(picked) == 0 {
+				return nil, errors.New("no releases selected")
+			}
+			return picked, nil
+		}
+		toggle, err := parseChoices(answer, len(releases))
+		if err != nil {
+			warnf("%s", err)
+			continue
+		}
+		for _, n := range toggle {
+			checked[releases[n-1]] = !checked[releases[n-1]]
+		}
+	}
+}
+
+// previewConflicts cherry-picks commits onto the upstream branch in a
+// temporary worktree and returns the paths that conflict, if any.
+func previewConflicts(c config, branch string, commits []string) ([]string, error) {
+	if err := fetchBranches(c, branch); err != nil {
+		return nil, fmt.Errorf("fetching %q branch: %w", branch, err)
+	}
+	dir, err := ioutil.TempDir("", "backport-preview")
+	if err != nil {
+		return nil, fmt.Errorf("creating preview worktree: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := spawn("git", "worktree", "add", "--quiet", "--detach", dir, "FETCH_HEAD"); err != nil {
+		return nil, fmt.Errorf("creating preview worktree: %w", err)
+	}
+	defer func() { _ = spawn("git", "worktree", "remove", "--force", dir) }()
+
+	args := append([]string{"git", "-C", dir, "cherry-pick", "--no-commit"}, commits...)
+	if _, err := capture(args...); err == nil {
+		return nil, nil
+	}
+	out, err := capture("git", "-C", dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, fmt.Errorf("listing conflicts: %w", err)
+	}
+	conflicts := strings.Fields(out)
+	if len(conflicts) == 0 {
+		return nil, errors.New("cherry-pick failed without conflicts")
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,55 @@
+package backport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// worktreePath returns the location of the throwaway worktree used for
+// backportBranch in --worktree mode. It is keyed by the repository too, so
+// that backports of the same PRs in different clones do not collide.
+func worktreePath(c config, backportBranch string) string {
+	sum := sha256.Sum256([]byte(c.gitDir))
+	return filepath.Join(os.TempDir(), "backport-worktrees", hex.EncodeToString(sum[:6]), backportBranch)
+}
+
+// addWorktree creates a worktree for p's backport branch at FETCH_HEAD and
+// switches the process into it, leaving the main checkout untouched.
+func addWorktree(p pendingBackport) error {
+	_, _ = capture("git", "worktree", "prune")
+	err := spawn("git", "worktree", "add", whenForced("--force", "--no-force"),
+		whenForced("-B", "-b"), p.BackportBranch, p.Worktree, "FETCH_HEAD")
+	if err != nil {
+		return fmt.Errorf("creating worktree for backport branch %q: %w", p.BackportBranch, err)
+	}
+	return enterWorktree(p)
+}
+
+// enterWorktree switches the process into p's worktree, if it has one, so that
+// subsequent Git commands operate on the backport branch.
+func enterWorktree(p pendingBackport) error {
+	if p.Worktree == "" {
+		return nil
+	}
+	if err := os.Chdir(p.Worktree); err != nil {
+		return fmt.Errorf("entering worktree: %w", err)
+	}
+	return nil
+}
+
+// removeWorktree deletes p's worktree. The backport branch itself is kept.
+func removeWorktree(p pendingBackport) error {
+	// Step out of the worktree, back into the one the backport was started
+	// from, before removing it. That need not be next to the Git directory,
+	// e.g. in submodules or with --separate-git-dir.
+	if err := os.Chdir(p.Origin); err != nil {
+		return fmt.Errorf("leaving worktree: %w", err)
+	}
+	if err := spawn("git", "worktree", "remove", "--force", p.Worktree); err != nil {
+		return fmt.Errorf("removing worktree %q: %w", p.Worktree, err)
+	}
+	return nil
+}